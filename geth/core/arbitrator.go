@@ -0,0 +1,281 @@
+package core
+
+import (
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+)
+
+// Arbitrator detects conflicts among EuResults produced by EUs running
+// against the same state snapshot. Results are checked in transaction order,
+// a result conflicts if it read or overwrote anything that an earlier accepted
+// result has written. Balance writes are deltas and commute with each other,
+// so they only conflict with balance reads. An account observed as existing
+// stays that way, so only reads of missing accounts are checked. A suicided
+// account conflicts with any access to it. Nonce reads are compared by value,
+// so a transaction reading the nonce written by an earlier one doesn't
+// conflict with it. The keys of the kernel API state are checked like storage
+// slots.
+type Arbitrator struct {
+	accountCache  EthAccountCache
+	suicided      map[common.Address]struct{}
+	newAccounts   map[common.Address]struct{}
+	balanceWrites map[common.Address]struct{}
+	nonceWrites   map[common.Address]uint64
+	codeWrites    map[common.Address]struct{}
+	storageWrites map[common.Address]map[common.Hash]struct{}
+	clibWrites    map[string]struct{}
+}
+
+// NewArbitrator creates an Arbitrator with no accepted results.
+func NewArbitrator() *Arbitrator {
+	return &Arbitrator{
+		suicided:      make(map[common.Address]struct{}),
+		newAccounts:   make(map[common.Address]struct{}),
+		balanceWrites: make(map[common.Address]struct{}),
+		nonceWrites:   make(map[common.Address]uint64),
+		codeWrites:    make(map[common.Address]struct{}),
+		storageWrites: make(map[common.Address]map[common.Hash]struct{}),
+		clibWrites:    make(map[string]struct{}),
+	}
+}
+
+// NewArbitratorWithState creates an Arbitrator that also checks the nonce
+// reads not written by any accepted result against the committed nonces in
+// eac. This is required for results executed with NonceCheckDeferred.
+func NewArbitratorWithState(eac EthAccountCache) *Arbitrator {
+	arb := NewArbitrator()
+	arb.accountCache = eac
+	return arb
+}
+
+// Conflicts reports whether result conflicts with the results accepted so far.
+func (arb *Arbitrator) Conflicts(result *types.EuResult) bool {
+	if len(arb.suicided) > 0 && arb.touchesSuicided(result) {
+		return true
+	}
+
+	if r := result.R; r != nil {
+		for addr := range r.BalanceReads {
+			if _, ok := arb.balanceWrites[addr]; ok {
+				return true
+			}
+		}
+		for addr, storage := range r.EthStorageReads {
+			if arb.storageWritten(addr, storage) {
+				return true
+			}
+		}
+		for addr, nonce := range r.NonceReads {
+			if written, ok := arb.nonceWrites[addr]; ok {
+				if written != nonce {
+					return true
+				}
+			} else if arb.accountCache != nil && arb.committedNonce(addr) != nonce {
+				return true
+			}
+		}
+		for addr := range r.CodeReads {
+			if _, ok := arb.codeWrites[addr]; ok {
+				return true
+			}
+		}
+		for addr, exist := range r.ExistenceReads {
+			if !exist && arb.accountWritten(addr) {
+				return true
+			}
+		}
+		if arb.clibWritten(r.ClibReads) {
+			return true
+		}
+	}
+
+	if w := result.W; w != nil {
+		for addr := range w.NonceWrites {
+			if _, ok := arb.nonceWrites[addr]; !ok {
+				continue
+			}
+			// Already checked by value if the nonce has been read.
+			if r := result.R; r == nil || !hasNonceRead(r, addr) {
+				return true
+			}
+		}
+		for addr := range w.CodeWrites {
+			if _, ok := arb.codeWrites[addr]; ok {
+				return true
+			}
+		}
+		for addr, storage := range w.EthStorageWrites {
+			if arb.storageWritten(addr, storage) {
+				return true
+			}
+		}
+		for _, addr := range w.Suicided {
+			if arb.accountWritten(addr) {
+				return true
+			}
+		}
+		if arb.clibWritten(w.ClibWrites) {
+			return true
+		}
+	}
+	return false
+}
+
+// touchesSuicided reports whether result has read or written any account
+// suicided by an accepted result.
+func (arb *Arbitrator) touchesSuicided(result *types.EuResult) bool {
+	var accessed []common.Address
+	if r := result.R; r != nil {
+		for addr := range r.BalanceReads {
+			accessed = append(accessed, addr)
+		}
+		for addr := range r.EthStorageReads {
+			accessed = append(accessed, addr)
+		}
+		for addr := range r.NonceReads {
+			accessed = append(accessed, addr)
+		}
+		for addr := range r.CodeReads {
+			accessed = append(accessed, addr)
+		}
+		for addr := range r.ExistenceReads {
+			accessed = append(accessed, addr)
+		}
+	}
+	if w := result.W; w != nil {
+		accessed = append(accessed, w.NewAccounts...)
+		accessed = append(accessed, w.Suicided...)
+		for addr := range w.NonceWrites {
+			accessed = append(accessed, addr)
+		}
+		for addr := range w.CodeWrites {
+			accessed = append(accessed, addr)
+		}
+		for addr := range w.EthStorageWrites {
+			accessed = append(accessed, addr)
+		}
+	}
+
+	for _, addr := range accessed {
+		if _, ok := arb.suicided[addr]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// accountWritten reports whether an accepted result has created addr or
+// written any of its fields.
+func (arb *Arbitrator) accountWritten(addr common.Address) bool {
+	for _, written := range []map[common.Address]struct{}{
+		arb.suicided,
+		arb.newAccounts,
+		arb.balanceWrites,
+		arb.codeWrites,
+	} {
+		if _, ok := written[addr]; ok {
+			return true
+		}
+	}
+	if _, ok := arb.nonceWrites[addr]; ok {
+		return true
+	}
+	_, ok := arb.storageWrites[addr]
+	return ok
+}
+
+// committedNonce returns the nonce of addr in the account cache.
+func (arb *Arbitrator) committedNonce(addr common.Address) uint64 {
+	if acc, _ := arb.accountCache.GetAccount(string(addr.Bytes())); acc != nil {
+		return acc.GetNonce()
+	}
+	return 0
+}
+
+func hasNonceRead(r *types.Reads, addr common.Address) bool {
+	_, ok := r.NonceReads[addr]
+	return ok
+}
+
+// storageWritten reports whether any of the given slots of addr has been
+// written by an accepted result.
+func (arb *Arbitrator) storageWritten(addr common.Address, slots map[common.Hash]common.Hash) bool {
+	written, ok := arb.storageWrites[addr]
+	if !ok {
+		return false
+	}
+	for key := range slots {
+		if _, ok := written[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// clibWritten reports whether any of the kernel API keys has been written by
+// an accepted result.
+func (arb *Arbitrator) clibWritten(keys []string) bool {
+	for _, key := range keys {
+		if _, ok := arb.clibWrites[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Accept adds the write set of result to the accepted writes. Later results
+// are checked against it.
+func (arb *Arbitrator) Accept(result *types.EuResult) {
+	w := result.W
+	if w == nil {
+		return
+	}
+
+	for _, addr := range w.NewAccounts {
+		arb.newAccounts[addr] = struct{}{}
+	}
+	for _, addr := range w.Suicided {
+		arb.suicided[addr] = struct{}{}
+	}
+	for addr := range w.BalanceWrites {
+		arb.balanceWrites[addr] = struct{}{}
+	}
+	for addr, nonce := range w.NonceWrites {
+		arb.nonceWrites[addr] = nonce
+	}
+	for addr := range w.CodeWrites {
+		arb.codeWrites[addr] = struct{}{}
+	}
+	for addr, storage := range w.EthStorageWrites {
+		if _, ok := arb.storageWrites[addr]; !ok {
+			arb.storageWrites[addr] = make(map[common.Hash]struct{})
+		}
+		for key := range storage {
+			arb.storageWrites[addr][key] = struct{}{}
+		}
+	}
+	for _, key := range w.ClibWrites {
+		arb.clibWrites[key] = struct{}{}
+	}
+}
+
+// Detect checks results in order, accepting every result that doesn't
+// conflict. It returns the hashes of the transactions that have to be dropped
+// or re-executed against the updated state.
+func (arb *Arbitrator) Detect(results []*types.EuResult) []common.Hash {
+	var conflicts []common.Hash
+	for _, result := range results {
+		if arb.Conflicts(result) {
+			conflicts = append(conflicts, result.H)
+			continue
+		}
+		arb.Accept(result)
+	}
+	return conflicts
+}
+
+// DetectConflicts arbitrates an ordered batch of EuResults and returns the
+// hashes of the conflicting transactions.
+func DetectConflicts(results []*types.EuResult) []common.Hash {
+	return NewArbitrator().Detect(results)
+}
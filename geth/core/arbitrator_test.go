@@ -0,0 +1,397 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+)
+
+func TestDetectConflicts(t *testing.T) {
+	a1 := common.BytesToAddress([]byte{1})
+	a2 := common.BytesToAddress([]byte{2})
+	a3 := common.BytesToAddress([]byte{3})
+	key1 := common.BytesToHash([]byte("key1"))
+	key2 := common.BytesToHash([]byte("key2"))
+	key3 := common.BytesToHash([]byte("key3"))
+
+	results := []*types.EuResult{
+		// Transfer from a1 to a2.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx1")),
+			R: &types.Reads{},
+			W: &types.Writes{
+				BalanceWrites: map[common.Address]*big.Int{
+					a1: new(big.Int).SetInt64(-1),
+					a2: new(big.Int).SetInt64(1),
+				},
+				NonceWrites: map[common.Address]uint64{
+					a1: 1,
+				},
+				EthStorageWrites: map[common.Address]map[common.Hash]common.Hash{
+					a3: map[common.Hash]common.Hash{
+						key1: common.BytesToHash([]byte("value1")),
+					},
+				},
+			},
+		},
+		// Balance writes commute.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx2")),
+			R: &types.Reads{},
+			W: &types.Writes{
+				BalanceWrites: map[common.Address]*big.Int{
+					a2: new(big.Int).SetInt64(1),
+				},
+			},
+		},
+		// Reads the balance of a2.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx3")),
+			R: &types.Reads{
+				BalanceReads: map[common.Address]*big.Int{
+					a2: new(big.Int).SetInt64(100),
+				},
+			},
+			W: &types.Writes{},
+		},
+		// Writes the nonce of a1.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx4")),
+			R: &types.Reads{},
+			W: &types.Writes{
+				NonceWrites: map[common.Address]uint64{
+					a1: 1,
+				},
+			},
+		},
+		// Writes another slot of a3.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx5")),
+			R: &types.Reads{},
+			W: &types.Writes{
+				EthStorageWrites: map[common.Address]map[common.Hash]common.Hash{
+					a3: map[common.Hash]common.Hash{
+						key2: common.BytesToHash([]byte("value2")),
+					},
+				},
+			},
+		},
+		// Reads a slot of a3 that hasn't been written.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx6")),
+			R: &types.Reads{
+				EthStorageReads: map[common.Address]map[common.Hash]common.Hash{
+					a3: map[common.Hash]common.Hash{
+						key3: common.Hash{},
+					},
+				},
+			},
+			W: &types.Writes{},
+		},
+		// Reads a slot of a3 written by tx1.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx7")),
+			R: &types.Reads{
+				EthStorageReads: map[common.Address]map[common.Hash]common.Hash{
+					a3: map[common.Hash]common.Hash{
+						key1: common.Hash{},
+					},
+				},
+			},
+			W: &types.Writes{},
+		},
+		// Failed transaction without read set.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx8")),
+			W: &types.Writes{
+				BalanceWrites: map[common.Address]*big.Int{
+					a1: new(big.Int).SetInt64(-1),
+				},
+			},
+		},
+	}
+
+	conflicts := DetectConflicts(results)
+	if len(conflicts) != 3 ||
+		conflicts[0] != results[2].H ||
+		conflicts[1] != results[3].H ||
+		conflicts[2] != results[6].H {
+		t.Errorf("Checking conflicts failed, got %v", conflicts)
+		return
+	}
+}
+
+func TestDetectConflictsOnAccountReads(t *testing.T) {
+	a1 := common.BytesToAddress([]byte{1})
+	a2 := common.BytesToAddress([]byte{2})
+	a3 := common.BytesToAddress([]byte{3})
+
+	results := []*types.EuResult{
+		// Deploys a contract at a2 and pays a3.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx1")),
+			R: &types.Reads{},
+			W: &types.Writes{
+				NewAccounts: []common.Address{a2},
+				BalanceWrites: map[common.Address]*big.Int{
+					a3: new(big.Int).SetInt64(1),
+				},
+				NonceWrites: map[common.Address]uint64{
+					a1: 1,
+				},
+				CodeWrites: map[common.Address][]byte{
+					a2: []byte{1},
+				},
+			},
+		},
+		// Reads the nonce of a1.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx2")),
+			R: &types.Reads{
+				NonceReads: map[common.Address]uint64{
+					a1: 0,
+				},
+			},
+		},
+		// Reads the code of a2.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx3")),
+			R: &types.Reads{
+				CodeReads: map[common.Address]common.Hash{
+					a2: common.Hash{},
+				},
+			},
+		},
+		// Observed a2 as missing.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx4")),
+			R: &types.Reads{
+				ExistenceReads: map[common.Address]bool{
+					a2: false,
+				},
+			},
+		},
+		// Observed a3 as existing, which the payment doesn't change.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx5")),
+			R: &types.Reads{
+				ExistenceReads: map[common.Address]bool{
+					a3: true,
+				},
+			},
+		},
+	}
+
+	conflicts := DetectConflicts(results)
+	if len(conflicts) != 3 ||
+		conflicts[0] != results[1].H ||
+		conflicts[1] != results[2].H ||
+		conflicts[2] != results[3].H {
+		t.Errorf("Checking conflicts failed, got %v", conflicts)
+		return
+	}
+}
+
+func TestDetectConflictsOnSuicide(t *testing.T) {
+	a1 := common.BytesToAddress([]byte{1})
+	a2 := common.BytesToAddress([]byte{2})
+	key1 := common.BytesToHash([]byte("key1"))
+
+	results := []*types.EuResult{
+		// a1 self-destructs.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx1")),
+			R: &types.Reads{},
+			W: &types.Writes{
+				Suicided: []common.Address{a1},
+			},
+		},
+		// Pays a1, balance writes commute.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx2")),
+			R: &types.Reads{},
+			W: &types.Writes{
+				BalanceWrites: map[common.Address]*big.Int{
+					a1: new(big.Int).SetInt64(1),
+				},
+			},
+		},
+		// Reads the storage of a1.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx3")),
+			R: &types.Reads{
+				EthStorageReads: map[common.Address]map[common.Hash]common.Hash{
+					a1: map[common.Hash]common.Hash{
+						key1: common.Hash{},
+					},
+				},
+			},
+		},
+		// Observed a1 as existing.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx4")),
+			R: &types.Reads{
+				ExistenceReads: map[common.Address]bool{
+					a1: true,
+				},
+			},
+		},
+		// Writes the nonce of a2, then a2 self-destructs.
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx5")),
+			R: &types.Reads{},
+			W: &types.Writes{
+				NonceWrites: map[common.Address]uint64{
+					a2: 1,
+				},
+			},
+		},
+		&types.EuResult{
+			H: common.BytesToHash([]byte("tx6")),
+			R: &types.Reads{},
+			W: &types.Writes{
+				Suicided: []common.Address{a2},
+			},
+		},
+	}
+
+	conflicts := DetectConflicts(results)
+	if len(conflicts) != 3 ||
+		conflicts[0] != results[2].H ||
+		conflicts[1] != results[3].H ||
+		conflicts[2] != results[5].H {
+		t.Errorf("Checking conflicts failed, got %v", conflicts)
+		return
+	}
+}
+
+func TestDetectConflictsOnDeferredNonces(t *testing.T) {
+	a1 := common.BytesToAddress([]byte{1})
+	a2 := common.BytesToAddress([]byte{2})
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(a1.Bytes()): &mockEthAccount{
+				balance: new(big.Int),
+				nonce:   5,
+			},
+			string(a2.Bytes()): &mockEthAccount{
+				balance: new(big.Int),
+				nonce:   5,
+			},
+		},
+	}
+	newResult := func(name string, addr common.Address, nonce uint64) *types.EuResult {
+		return &types.EuResult{
+			H: common.BytesToHash([]byte(name)),
+			R: &types.Reads{
+				NonceReads: map[common.Address]uint64{
+					addr: nonce,
+				},
+			},
+			W: &types.Writes{
+				NonceWrites: map[common.Address]uint64{
+					addr: nonce + 1,
+				},
+			},
+		}
+	}
+
+	results := []*types.EuResult{
+		newResult("tx1", a1, 5),
+		newResult("tx2", a1, 6),
+		// Replays the nonce of tx2.
+		newResult("tx3", a1, 6),
+		// Skips a nonce.
+		newResult("tx4", a2, 6),
+	}
+
+	conflicts := NewArbitratorWithState(mock).Detect(results)
+	if len(conflicts) != 2 ||
+		conflicts[0] != results[2].H ||
+		conflicts[1] != results[3].H {
+		t.Errorf("Checking conflicts failed, got %v", conflicts)
+		return
+	}
+}
+
+func TestDetectConflictsOnKernelAPI(t *testing.T) {
+	newResult := func(name string, reads, writes []string) *types.EuResult {
+		return &types.EuResult{
+			H: common.BytesToHash([]byte(name)),
+			R: &types.Reads{
+				ClibReads: reads,
+			},
+			W: &types.Writes{
+				ClibWrites: writes,
+			},
+		}
+	}
+
+	results := []*types.EuResult{
+		newResult("tx1", nil, []string{"users"}),
+		// Reads what tx1 has written.
+		newResult("tx2", []string{"users"}, nil),
+		// Writes what tx1 has written.
+		newResult("tx3", nil, []string{"users"}),
+		newResult("tx4", []string{"admins"}, []string{"admins"}),
+	}
+
+	conflicts := DetectConflicts(results)
+	if len(conflicts) != 2 ||
+		conflicts[0] != results[1].H ||
+		conflicts[1] != results[2].H {
+		t.Errorf("Checking conflicts failed, got %v", conflicts)
+		return
+	}
+}
+
+func TestDetectConflictsOnFailedTransaction(t *testing.T) {
+	setter := common.BytesToAddress([]byte("setter"))
+	checker := common.BytesToAddress([]byte("checker"))
+	contract := common.BytesToAddress([]byte("contract"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(setter.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+			string(checker.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+			string(contract.Bytes()): &mockEthAccount{
+				balance: new(big.Int),
+			},
+			string(newTestConfig().Coinbase.Bytes()): &mockEthAccount{
+				balance: new(big.Int),
+			},
+		},
+		codes: map[string][]byte{
+			// if calldatasize { sstore(0, 1) } else if iszero(sload(0)) { revert(0, 0) }
+			string(contract.Bytes()): common.Hex2Bytes("36601157600054600f5760006000fd5b005b600160005500"),
+		},
+	}
+
+	// tx2 reverts because it doesn't see the slot set by tx1, it must be
+	// reported even though its writes are only the gas and the nonce.
+	msgs := []*types.Messager{
+		newTestMessager(setter, &contract, 0, 0, []byte{1}),
+		newTestMessager(checker, &contract, 0, 0, nil),
+	}
+	executor := NewParallelExecutor(newTestConfig(), 2, newMockKernelAPI)
+	results, receipts, errs := executor.Run(mock, mock, msgs)
+	if errs[0] != nil || errs[1] != nil ||
+		receipts[0].Status != types.ReceiptStatusSuccessful ||
+		receipts[1].Status != types.ReceiptStatusFailed {
+		t.Error("Checking execution failed")
+		return
+	}
+
+	conflicts := DetectConflicts(results)
+	if len(conflicts) != 1 || conflicts[0] != results[1].H {
+		t.Errorf("Checking conflicts failed, got %v", conflicts)
+		return
+	}
+}
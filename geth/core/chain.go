@@ -0,0 +1,47 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+)
+
+// MemoryChain is a ChainContext keeping the headers in memory. It is safe for
+// concurrent use.
+type MemoryChain struct {
+	mu      sync.RWMutex
+	headers map[common.Hash]*types.Header
+}
+
+// NewMemoryChain creates a MemoryChain holding headers.
+func NewMemoryChain(headers ...*types.Header) *MemoryChain {
+	chain := &MemoryChain{
+		headers: make(map[common.Hash]*types.Header),
+	}
+	for _, header := range headers {
+		chain.AddHeader(header)
+	}
+	return chain
+}
+
+// AddHeader adds header to the chain.
+func (chain *MemoryChain) AddHeader(header *types.Header) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	chain.headers[header.Hash()] = header
+}
+
+// GetHeader returns the header with the given hash and number, or nil if it is
+// unknown.
+func (chain *MemoryChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+
+	header, ok := chain.headers[hash]
+	if !ok || header.Number.Uint64() != number {
+		return nil
+	}
+	return header
+}
@@ -5,6 +5,7 @@ import (
 	"math/big"
 
 	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
 	"github.com/HPISTechnologies/mevm/geth/crypto"
 )
 
@@ -14,6 +15,12 @@ type dirtyAccount struct {
 	code     []byte
 	codeHash []byte
 	storage  map[string]string
+	// cleared is set when the account has suicided, the code and storage
+	// in the underlying caches are no longer visible.
+	cleared bool
+	// deleted is set when the account has suicided and hasn't been written
+	// since, it no longer exists.
+	deleted bool
 }
 
 func newDirtyAccount() *dirtyAccount {
@@ -23,6 +30,15 @@ func newDirtyAccount() *dirtyAccount {
 	}
 }
 
+// newDeletedAccount returns the account left by a suicide, it has no balance,
+// nonce, code or storage.
+func newDeletedAccount() *dirtyAccount {
+	da := newDirtyAccount()
+	da.cleared = true
+	da.deleted = true
+	return da
+}
+
 func newDirtyAccountFrom(acc Account) *dirtyAccount {
 	return &dirtyAccount{
 		balance:  acc.GetBalance(),
@@ -60,13 +76,16 @@ func newDirtyCache(accountCache EthAccountCache, storageCache EthStorageCache) *
 
 func (dc *dirtyCache) GetAccount(addr string) (Account, error) {
 	if acc, ok := dc.dirties[addr]; ok {
+		if acc.deleted {
+			return nil, nil
+		}
 		return acc, nil
 	}
 	return dc.accountCache.GetAccount(addr)
 }
 
 func (dc *dirtyCache) GetCode(addr string) ([]byte, error) {
-	if acc, ok := dc.dirties[addr]; ok && acc.code != nil {
+	if acc, ok := dc.dirties[addr]; ok && (acc.code != nil || acc.cleared) {
 		return acc.code, nil
 	}
 	return dc.accountCache.GetCode(addr)
@@ -77,80 +96,142 @@ func (dc *dirtyCache) GetState(addr string, key []byte) []byte {
 		if value, ok := acc.storage[string(key)]; ok {
 			return []byte(value)
 		}
+		if acc.cleared {
+			return nil
+		}
 	}
 	return dc.storageCache.GetState(addr, key)
 }
 
+// load returns the dirty account of addr, copying it from the account cache
+// on first use. An account missing from the cache, or deleted, is created
+// empty.
+func (dc *dirtyCache) load(addr common.Address) *dirtyAccount {
+	if acc, ok := dc.dirties[string(addr.Bytes())]; ok {
+		acc.deleted = false
+		return acc
+	}
+
+	acc, err := dc.accountCache.GetAccount(string(addr.Bytes()))
+	if err != nil {
+		panic(fmt.Sprintf("unexpected error: %v", err))
+	}
+	var da *dirtyAccount
+	if acc == nil {
+		da = newDirtyAccount()
+	} else {
+		da = newDirtyAccountFrom(acc)
+	}
+	dc.dirties[string(addr.Bytes())] = da
+	return da
+}
+
 func (dc *dirtyCache) localCommit(
 	newlyCreated map[common.Address]struct{},
 	balanceWrites map[common.Address]*big.Int,
 	nonceWrites map[common.Address]uint64,
 	codeWrites map[common.Address][]byte,
 	storageWrites map[common.Address]map[common.Hash]common.Hash,
+	suicided map[common.Address]struct{},
 ) {
 	for addr := range newlyCreated {
-		dc.dirties[string(addr.Bytes())] = newDirtyAccount()
+		da := newDirtyAccount()
+		if acc, ok := dc.dirties[string(addr.Bytes())]; ok {
+			da.cleared = acc.cleared
+		}
+		dc.dirties[string(addr.Bytes())] = da
 	}
 
 	for addr, amount := range balanceWrites {
-		if acc, ok := dc.dirties[string(addr.Bytes())]; ok {
-			acc.balance = new(big.Int).Add(acc.balance, amount)
-		} else {
-			acc, err := dc.accountCache.GetAccount(string(addr.Bytes()))
-			if err != nil {
-				panic(fmt.Sprintf("unexpected error: %v", err))
-			}
-			da := newDirtyAccountFrom(acc)
-			da.balance = new(big.Int).Add(da.balance, amount)
-			dc.dirties[string(addr.Bytes())] = da
-		}
+		acc := dc.load(addr)
+		acc.balance = new(big.Int).Add(acc.balance, amount)
 	}
 
 	for addr, nonce := range nonceWrites {
-		if acc, ok := dc.dirties[string(addr.Bytes())]; ok {
-			acc.nonce = nonce
-		} else {
-			acc, err := dc.accountCache.GetAccount(string(addr.Bytes()))
-			if err != nil {
-				panic(fmt.Sprintf("unexpected error: %v", err))
-			}
-			da := newDirtyAccountFrom(acc)
-			da.nonce = nonce
-			dc.dirties[string(addr.Bytes())] = da
-		}
+		dc.load(addr).nonce = nonce
 	}
 
 	for addr, code := range codeWrites {
-		if acc, ok := dc.dirties[string(addr.Bytes())]; ok {
-			acc.code = code
-			acc.codeHash = crypto.Keccak256Hash(code).Bytes()
-		} else {
-			acc, err := dc.accountCache.GetAccount(string(addr.Bytes()))
-			if err != nil {
-				panic(fmt.Sprintf("unexpected error: %v", err))
-			}
-			da := newDirtyAccountFrom(acc)
-			da.code = code
-			da.codeHash = crypto.Keccak256Hash(code).Bytes()
-			dc.dirties[string(addr.Bytes())] = da
-		}
+		acc := dc.load(addr)
+		acc.code = code
+		acc.codeHash = crypto.Keccak256Hash(code).Bytes()
 	}
 
 	for addr, storage := range storageWrites {
-		if acc, ok := dc.dirties[string(addr.Bytes())]; ok {
-			for k, v := range storage {
-				acc.storage[string(k.Bytes())] = string(v.Bytes())
-			}
-		} else {
-			acc, err := dc.accountCache.GetAccount(string(addr.Bytes()))
-			if err != nil {
-				panic(fmt.Sprintf("unexpected error: %v", err))
-			}
-			da := newDirtyAccountFrom(acc)
-			for k, v := range storage {
-				da.storage[string(k.Bytes())] = string(v.Bytes())
-			}
-			dc.dirties[string(addr.Bytes())] = da
+		acc := dc.load(addr)
+		for k, v := range storage {
+			acc.storage[string(k.Bytes())] = string(v.Bytes())
+		}
+	}
+
+	// Suicides happen after the other writes of the transaction, they delete
+	// the account with its balance and nonce.
+	for addr := range suicided {
+		dc.dirties[string(addr.Bytes())] = newDeletedAccount()
+	}
+}
+
+// merge commits a write set of an EuResult.
+func (dc *dirtyCache) merge(writes *types.Writes) {
+	newlyCreated := make(map[common.Address]struct{}, len(writes.NewAccounts))
+	for _, addr := range writes.NewAccounts {
+		newlyCreated[addr] = struct{}{}
+	}
+	suicided := make(map[common.Address]struct{}, len(writes.Suicided))
+	for _, addr := range writes.Suicided {
+		suicided[addr] = struct{}{}
+	}
+	dc.localCommit(
+		newlyCreated,
+		writes.BalanceWrites,
+		writes.NonceWrites,
+		writes.CodeWrites,
+		writes.EthStorageWrites,
+		suicided,
+	)
+}
+
+// Overlay is a committed view of the state, made of a pair of base caches and
+// the write sets merged on top of them. It implements both EthAccountCache and
+// EthStorageCache, so it can be handed to the next generation of EUs.
+type Overlay struct {
+	cache *dirtyCache
+}
+
+// NewOverlay creates an Overlay over eac and esc with no writes merged.
+func NewOverlay(eac EthAccountCache, esc EthStorageCache) *Overlay {
+	return &Overlay{
+		cache: newDirtyCache(eac, esc),
+	}
+}
+
+// MergeWrites creates an Overlay over eac and esc and merges writes into it.
+func MergeWrites(eac EthAccountCache, esc EthStorageCache, writes []*types.Writes) *Overlay {
+	overlay := NewOverlay(eac, esc)
+	overlay.Merge(writes...)
+	return overlay
+}
+
+// Merge applies writes in order. Within a write set, the new accounts are
+// created first, then the balance deltas, nonces, code and storage are
+// applied, and the suicided accounts are cleared last. Nil write sets are
+// skipped. Merge must not be called while the Overlay is being read.
+func (o *Overlay) Merge(writes ...*types.Writes) {
+	for _, w := range writes {
+		if w != nil {
+			o.cache.merge(w)
 		}
 	}
 }
+
+func (o *Overlay) GetAccount(addr string) (Account, error) {
+	return o.cache.GetAccount(addr)
+}
+
+func (o *Overlay) GetCode(addr string) ([]byte, error) {
+	return o.cache.GetCode(addr)
+}
+
+func (o *Overlay) GetState(addr string, key []byte) []byte {
+	return o.cache.GetState(addr, key)
+}
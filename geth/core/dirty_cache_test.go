@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
 )
 
 type mockEthAccount struct {
@@ -112,7 +113,8 @@ func TestDirtyCacheLocalCommit(t *testing.T) {
 			a3: map[common.Hash]common.Hash{
 				common.BytesToHash([]byte("key1")): common.BytesToHash([]byte("value1")),
 			},
-		})
+		},
+		nil)
 
 	acc1, _ := dirtyCache.GetAccount(s1)
 	if acc1.GetBalance().Cmp(new(big.Int).SetInt64(101)) != 0 ||
@@ -166,3 +168,182 @@ func TestDirtyCacheLocalCommit(t *testing.T) {
 		return
 	}
 }
+
+func TestDirtyCacheSuicide(t *testing.T) {
+	a1 := common.BytesToAddress([]byte("suicided"))
+	s1 := string(a1.Bytes())
+	key := common.BytesToHash([]byte("key"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			s1: &mockEthAccount{
+				balance: new(big.Int).SetInt64(100),
+			},
+		},
+		codes: map[string][]byte{
+			s1: []byte{1},
+		},
+		storages: map[string]map[string]string{
+			s1: map[string]string{
+				string(key.Bytes()): string(common.BytesToHash([]byte("value")).Bytes()),
+			},
+		},
+	}
+	dirtyCache := newDirtyCache(mock, mock)
+
+	dirtyCache.localCommit(
+		nil,
+		map[common.Address]*big.Int{
+			a1: new(big.Int).SetInt64(-100),
+		},
+		map[common.Address]uint64{
+			a1: 1,
+		},
+		nil,
+		nil,
+		map[common.Address]struct{}{
+			a1: struct{}{},
+		})
+
+	// The suicided account no longer exists.
+	if acc, _ := dirtyCache.GetAccount(s1); acc != nil {
+		t.Error("Checking suicided account failed")
+		return
+	}
+	if code, _ := dirtyCache.GetCode(s1); code != nil || dirtyCache.GetState(s1, key.Bytes()) != nil {
+		t.Error("Checking code and state of suicided account failed")
+		return
+	}
+
+	// Value sent to it afterwards recreates it empty.
+	dirtyCache.localCommit(
+		nil,
+		map[common.Address]*big.Int{
+			a1: new(big.Int).SetInt64(5),
+		},
+		nil,
+		nil,
+		nil,
+		nil)
+	acc, _ := dirtyCache.GetAccount(s1)
+	if acc == nil ||
+		acc.GetBalance().Cmp(new(big.Int).SetInt64(5)) != 0 ||
+		acc.GetNonce() != 0 {
+		t.Error("Checking recreated account failed")
+		return
+	}
+	if code, _ := dirtyCache.GetCode(s1); code != nil || dirtyCache.GetState(s1, key.Bytes()) != nil {
+		t.Error("Checking code and state of recreated account failed")
+		return
+	}
+}
+
+func TestMergeWrites(t *testing.T) {
+	a1 := common.BytesToAddress([]byte{1})
+	a2 := common.BytesToAddress([]byte{2})
+	a3 := common.BytesToAddress([]byte{3})
+	s1 := string(a1.Bytes())
+	s2 := string(a2.Bytes())
+	s3 := string(a3.Bytes())
+	key1 := common.BytesToHash([]byte("key1"))
+	key2 := common.BytesToHash([]byte("key2"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			s1: &mockEthAccount{
+				balance: new(big.Int).SetInt64(100),
+			},
+		},
+		codes: map[string][]byte{
+			s1: []byte{1},
+		},
+		storages: map[string]map[string]string{
+			s1: map[string]string{
+				string(key1.Bytes()): string(common.BytesToHash([]byte("value1")).Bytes()),
+			},
+		},
+	}
+
+	writes := []*types.Writes{
+		&types.Writes{
+			BalanceWrites: map[common.Address]*big.Int{
+				a1: new(big.Int).SetInt64(-10),
+				a2: new(big.Int).SetInt64(10),
+			},
+			NonceWrites: map[common.Address]uint64{
+				a1: 1,
+			},
+			EthStorageWrites: map[common.Address]map[common.Hash]common.Hash{
+				a1: map[common.Hash]common.Hash{
+					key1: common.BytesToHash([]byte("value11")),
+				},
+			},
+		},
+		nil,
+		&types.Writes{
+			NewAccounts: []common.Address{a3},
+			BalanceWrites: map[common.Address]*big.Int{
+				a1: new(big.Int).SetInt64(-5),
+				a2: new(big.Int).SetInt64(5),
+			},
+			NonceWrites: map[common.Address]uint64{
+				a1: 2,
+				a3: 1,
+			},
+			CodeWrites: map[common.Address][]byte{
+				a3: []byte{3},
+			},
+			EthStorageWrites: map[common.Address]map[common.Hash]common.Hash{
+				a1: map[common.Hash]common.Hash{
+					key2: common.BytesToHash([]byte("value2")),
+				},
+			},
+		},
+	}
+	overlay := MergeWrites(mock, mock, writes)
+
+	acc1, _ := overlay.GetAccount(s1)
+	if acc1.GetBalance().Cmp(new(big.Int).SetInt64(85)) != 0 ||
+		acc1.GetNonce() != 2 {
+		t.Error("Checking acc1 failed")
+		return
+	}
+	if bytes.Compare(overlay.GetState(s1, key1.Bytes()), common.BytesToHash([]byte("value11")).Bytes()) != 0 ||
+		bytes.Compare(overlay.GetState(s1, key2.Bytes()), common.BytesToHash([]byte("value2")).Bytes()) != 0 {
+		t.Error("Checking state of acc1 failed")
+		return
+	}
+
+	// a2 doesn't exist in the base cache.
+	acc2, _ := overlay.GetAccount(s2)
+	if acc2 == nil || acc2.GetBalance().Cmp(new(big.Int).SetInt64(15)) != 0 {
+		t.Error("Checking acc2 failed")
+		return
+	}
+
+	acc3, _ := overlay.GetAccount(s3)
+	code3, _ := overlay.GetCode(s3)
+	if acc3 == nil || acc3.GetNonce() != 1 || bytes.Compare(code3, []byte{3}) != 0 {
+		t.Error("Checking acc3 failed")
+		return
+	}
+
+	// The next generation merges on top of the overlay.
+	next := MergeWrites(overlay, overlay, []*types.Writes{
+		&types.Writes{
+			NonceWrites: map[common.Address]uint64{
+				a1: 3,
+			},
+		},
+	})
+	acc1, _ = next.GetAccount(s1)
+	if acc1.GetBalance().Cmp(new(big.Int).SetInt64(85)) != 0 ||
+		acc1.GetNonce() != 3 {
+		t.Error("Checking next generation failed")
+		return
+	}
+	if acc1, _ = overlay.GetAccount(s1); acc1.GetNonce() != 2 {
+		t.Error("Checking overlay after merge failed")
+		return
+	}
+}
@@ -16,7 +16,12 @@
 
 package core
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+)
 
 var (
 	// ErrKnownBlock is returned when a block to import is already known locally.
@@ -32,6 +37,14 @@ var (
 	// ErrNonceTooHigh is returned if the nonce of a transaction is higher than the
 	// next one expected based on the local chain.
 	ErrNonceTooHigh = errors.New("nonce too high")
+
+	// ErrInsufficientBalanceForGas is returned if the sender can't pay for the
+	// gas limit of a transaction at its gas price.
+	ErrInsufficientBalanceForGas = errors.New("insufficient balance to pay for gas")
+
+	// ErrIntrinsicGas is returned if the transaction is specified to use less gas
+	// than required to start the invocation.
+	ErrIntrinsicGas = errors.New("intrinsic gas too low")
 )
 
 var (
@@ -39,3 +52,20 @@ var (
 	// one present in the local chain.
 	ErrNonceTooLow = errors.New("nonce too low")
 )
+
+// InvalidTransactionError is returned by EU.Run if a transaction can't be
+// included in a block, like when the sender can't pay for the gas. Unlike a
+// failed execution, it doesn't change the state and no fee is charged.
+type InvalidTransactionError struct {
+	Hash common.Hash
+	Err  error
+}
+
+func (e *InvalidTransactionError) Error() string {
+	return fmt.Sprintf("invalid transaction %x: %v", e.Hash, e.Err)
+}
+
+// Unwrap returns the reason why the transaction is invalid.
+func (e *InvalidTransactionError) Unwrap() error {
+	return e.Err
+}
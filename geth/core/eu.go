@@ -6,73 +6,126 @@ import (
 	"github.com/HPISTechnologies/mevm/geth/common"
 	"github.com/HPISTechnologies/mevm/geth/core/types"
 	"github.com/HPISTechnologies/mevm/geth/core/vm"
-	"github.com/HPISTechnologies/mevm/geth/crypto"
 )
 
 type EU struct {
-	evm   *vm.EVM
-	state StateDB
-	kapi  KernelAPI
+	evm        *vm.EVM
+	state      StateDB
+	kapi       KernelAPI
+	gp         *GasPool
+	nonceCheck NonceCheck
 }
 
 func NewEU(euID uint16, state StateDB, kapi KernelAPI, cfg *Config) *EU {
 	return &EU{
-		evm:   vm.NewEVM(NewEVMContext(cfg), state, cfg.ChainConfig, *cfg.VMConfig, kapi),
-		state: state,
-		kapi:  kapi,
+		evm:        vm.NewEVM(NewEVMContext(cfg), state, cfg.ChainConfig, *cfg.VMConfig, kapi),
+		state:      state,
+		kapi:       kapi,
+		nonceCheck: cfg.NonceCheck,
 	}
 }
 
+// SetBlockContext prepares the EU for the block described by cfg. The EVM
+// context is rebuilt from the block fields of cfg, and the chain rules, gas
+// table and jump table follow the new block number, so an EU can be kept
+// across blocks, fork boundaries included.
+func (eu *EU) SetBlockContext(cfg *Config) {
+	eu.evm.SetContext(NewEVMContext(cfg))
+	eu.nonceCheck = cfg.NonceCheck
+}
+
+// SetGasPool sets the pool the gas of the messages is bought from. The pool can
+// be shared by EUs running the same block, a nil pool doesn't limit the gas.
+func (eu *EU) SetGasPool(gp *GasPool) {
+	eu.gp = gp
+}
+
 func (eu *EU) SetApc(eac EthAccountCache, esc EthStorageCache) {
 	eu.state.Set(eac, esc)
 	// eu.kapi.SetSnapshot(snapshot)
 }
 
-func (eu *EU) Run(hash common.Hash, msg *types.Message, coinbase common.Address) (*types.EuResult, *types.Receipt) {
+// Run executes msg and returns its result and receipt. If the message can't
+// be included in a block, an *InvalidTransactionError is returned instead, the
+// state is left untouched and the message should be dropped.
+func (eu *EU) Run(hash common.Hash, msg *types.Message, coinbase common.Address) (*types.EuResult, *types.Receipt, error) {
+	execResult, err := eu.apply(hash, msg, coinbase)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, receipt := eu.collect(hash, msg, execResult)
+	return result, receipt, nil
+}
+
+// apply executes msg against the state of the EU. The reads and writes are
+// left in the state until the next message is applied.
+func (eu *EU) apply(hash common.Hash, msg *types.Message, coinbase common.Address) (*ExecutionResult, error) {
 	eu.state.Prepare(hash, common.Hash{}, 0)
 	eu.kapi.Prepare(hash)
 
 	eu.evm.Context.Coinbase = coinbase
 	eu.evm.Context = ResetEVMContext(eu.evm.Context, *msg)
 
-	_, gas, failed, _ := ApplyMessage(eu.evm, *msg)
+	snapshot := eu.state.Snapshot()
+	execResult, err := ApplyMessage(eu.evm, *msg, eu.gp, eu.nonceCheck)
+	if err != nil {
+		// Drop the changes made before the message was found invalid, like
+		// the gas bought, so that they are not committed in sequential mode.
+		eu.state.RevertToSnapshot(snapshot)
+		return nil, &InvalidTransactionError{Hash: hash, Err: err}
+	}
+	return execResult, nil
+}
+
+// collect builds the EuResult and the receipt of the message applied last.
+func (eu *EU) collect(hash common.Hash, msg *types.Message, execResult *ExecutionResult) (*types.EuResult, *types.Receipt) {
+	var rs, ws []string
+	if collector, ok := eu.kapi.(KernelAPICollector); ok {
+		rs, ws = collector.Collect()
+	}
+	// The reads are kept even if the execution has failed, its outcome
+	// depends on them.
+	reads := &types.Reads{
+		ClibReads:       rs,
+		BalanceReads:    eu.state.(*ethState).balanceReads,
+		EthStorageReads: eu.state.(*ethState).storageReads,
+		NonceReads:      eu.state.(*ethState).nonceReads,
+		CodeReads:       eu.state.(*ethState).codeReads,
+		ExistenceReads:  eu.state.(*ethState).existenceReads,
+	}
 
 	var result *types.EuResult = nil
-	if !failed {
-		// rs, ws := eu.kapi.Collect()
-		storageReads := make([]common.Address, 0, len(eu.state.(*ethState).storageReads))
-		for acc := range eu.state.(*ethState).storageReads {
-			storageReads = append(storageReads, acc)
-		}
-		reads := &types.Reads{
-			// ClibReads:       rs,
-			BalanceReads:    eu.state.(*ethState).balanceReads,
-			EthStorageReads: storageReads,
-		}
+	if !execResult.Failed() {
 		newAccounts := make([]common.Address, 0, len(eu.state.(*ethState).newlyCreated))
 		for acc := range eu.state.(*ethState).newlyCreated {
 			newAccounts = append(newAccounts, acc)
 		}
+		suicided := make([]common.Address, 0, len(eu.state.(*ethState).suicided))
+		for acc := range eu.state.(*ethState).suicided {
+			suicided = append(suicided, acc)
+		}
 		writes := &types.Writes{
-			// ClibWrites:       ws,
+			ClibWrites:       ws,
 			NewAccounts:      newAccounts,
 			BalanceWrites:    eu.state.(*ethState).balanceWrites,
 			NonceWrites:      eu.state.(*ethState).nonceWrites,
 			CodeWrites:       eu.state.(*ethState).codeWrites,
 			EthStorageWrites: eu.state.(*ethState).storageWrites,
+			Suicided:         suicided,
 		}
 		result = &types.EuResult{
 			R: reads,
 			W: writes,
 		}
 	} else {
-		balanceWrites := make(map[common.Address]*big.Int)
-		balanceWrites[eu.evm.Coinbase] = new(big.Int).Mul(new(big.Int).SetUint64(gas), msg.GasPrice())
-		balanceWrites[msg.From()] = new(big.Int).Neg(balanceWrites[eu.evm.Coinbase])
+		// The changes made by the execution have been reverted, what's left
+		// is the gas fee and the nonce increment of the sender.
 		writes := &types.Writes{
-			BalanceWrites: balanceWrites,
+			BalanceWrites: eu.state.(*ethState).balanceWrites,
+			NonceWrites:   eu.state.(*ethState).nonceWrites,
 		}
 		result = &types.EuResult{
+			R: reads,
 			W: writes,
 		}
 	}
@@ -83,11 +136,13 @@ func (eu *EU) Run(hash common.Hash, msg *types.Message, coinbase common.Address)
 	}
 	result.W.BalanceOrigin = balanceOrigin
 
-	receipt := types.NewReceipt(nil, failed, gas)
+	// The receipt only covers the message itself, its cumulative gas and block
+	// fields are filled in by the Processor.
+	receipt := types.NewReceipt(nil, execResult.Failed(), execResult.UsedGas)
 	receipt.TxHash = hash
-	receipt.GasUsed = gas
+	receipt.GasUsed = execResult.UsedGas
 	if msg.To() == nil {
-		receipt.ContractAddress = crypto.CreateAddress(eu.evm.Context.Origin, msg.Nonce())
+		receipt.ContractAddress = execResult.ContractAddress
 	}
 	receipt.Logs = eu.state.GetLogs(hash)
 	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
@@ -95,6 +150,8 @@ func (eu *EU) Run(hash common.Hash, msg *types.Message, coinbase common.Address)
 	result.H = hash
 	result.Status = receipt.Status
 	result.GasUsed = receipt.GasUsed
+	result.ReturnData = execResult.ReturnData
+	result.Err = execResult.Err
 
 	return result, receipt
 }
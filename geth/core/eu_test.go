@@ -0,0 +1,866 @@
+package core
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+	"github.com/HPISTechnologies/mevm/geth/core/vm"
+	"github.com/HPISTechnologies/mevm/geth/crypto"
+	"github.com/HPISTechnologies/mevm/geth/crypto/blake2b"
+	"github.com/HPISTechnologies/mevm/geth/params"
+	xblake2b "golang.org/x/crypto/blake2b"
+)
+
+func TestFailedTransaction(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	reverter := common.BytesToAddress([]byte("reverter"))
+	cfg := newTestConfig()
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+			string(reverter.Bytes()): &mockEthAccount{
+				balance: new(big.Int),
+			},
+		},
+		codes: map[string][]byte{
+			// mstore(0, 1) revert(0, 32)
+			string(reverter.Bytes()): common.Hex2Bytes("600160005260206000fd"),
+		},
+	}
+
+	kapi := newMockKernelAPI()
+	eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+	msg := newTestMessager(sender, &reverter, 0, 100, nil)
+	result, receipt, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+	if err != nil {
+		t.Errorf("Checking error failed, got %v", err)
+		return
+	}
+	if receipt.Status != 0 || result.Status != 0 || result.Err != vm.ErrExecutionReverted {
+		t.Error("Checking status failed")
+		return
+	}
+	if !bytes.Equal(result.ReturnData, common.BigToHash(big.NewInt(1)).Bytes()) {
+		t.Errorf("Checking return data failed, got %x", result.ReturnData)
+		return
+	}
+	if result.W.NonceWrites[sender] != 1 {
+		t.Error("Checking nonce write failed")
+		return
+	}
+	fee := new(big.Int).SetUint64(result.GasUsed)
+	if len(result.W.BalanceWrites) != 2 ||
+		result.W.BalanceWrites[sender].Cmp(new(big.Int).Neg(fee)) != 0 ||
+		result.W.BalanceWrites[*cfg.Coinbase].Cmp(fee) != 0 {
+		t.Errorf("Checking balance writes failed, got %v", result.W.BalanceWrites)
+		return
+	}
+}
+
+func TestInvalidTransaction(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	poor := common.BytesToAddress([]byte{2})
+	receiver := common.BytesToAddress([]byte("receiver"))
+	cfg := newTestConfig()
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+			string(poor.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000),
+			},
+		},
+	}
+
+	kapi := newMockKernelAPI()
+	state := NewStateDBInSequentialMode(mock, mock, kapi)
+	eu := NewEU(0, state, kapi, cfg)
+
+	msg := newTestMessager(poor, &receiver, 0, 1, nil)
+	result, receipt, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+	var invalid *InvalidTransactionError
+	if result != nil || receipt != nil ||
+		!errors.As(err, &invalid) || invalid.Hash != msg.Txhash ||
+		!errors.Is(err, ErrInsufficientBalanceForGas) {
+		t.Errorf("Checking insufficient balance failed, got %v", err)
+		return
+	}
+
+	// The gas is bought before the intrinsic gas is checked.
+	m := types.NewMessage(sender, &receiver, 0, new(big.Int).SetInt64(1), 20000, new(big.Int).SetInt64(1), nil, nil, false)
+	result, receipt, err = eu.Run(common.BytesToHash([]byte("tx2")), &m, *cfg.Coinbase)
+	if result != nil || receipt != nil || !errors.Is(err, ErrIntrinsicGas) {
+		t.Errorf("Checking intrinsic gas failed, got %v", err)
+		return
+	}
+	if len(state.(*ethState).balanceWrites) != 0 || len(state.(*ethState).nonceWrites) != 0 {
+		t.Error("Checking writes of invalid transaction failed")
+		return
+	}
+
+	// Nothing is committed in sequential mode.
+	state.Prepare(common.Hash{}, common.Hash{}, 0)
+	if state.GetBalance(sender).Cmp(new(big.Int).SetInt64(1000000)) != 0 {
+		t.Error("Checking sender balance failed")
+		return
+	}
+}
+
+func TestNonceCheck(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	receiver := common.BytesToAddress([]byte("receiver"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+				nonce:   5,
+			},
+		},
+	}
+	newMsg := func(nonce uint64) *types.Message {
+		msg := types.NewMessage(sender, &receiver, nonce, new(big.Int).SetInt64(1), 100000, new(big.Int).SetInt64(1), nil, nil, true)
+		return &msg
+	}
+	run := func(mode NonceCheck, nonce uint64) (*types.EuResult, error) {
+		cfg := newTestConfig()
+		cfg.NonceCheck = mode
+		kapi := newMockKernelAPI()
+		eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+		result, _, err := eu.Run(common.Hash{}, newMsg(nonce), *cfg.Coinbase)
+		return result, err
+	}
+
+	if _, err := run(NonceCheckSkip, 3); err != nil {
+		t.Errorf("Checking skip failed, got %v", err)
+		return
+	}
+	if _, err := run(NonceCheckStrict, 4); !errors.Is(err, ErrNonceTooLow) {
+		t.Errorf("Checking strict with low nonce failed, got %v", err)
+		return
+	}
+	if _, err := run(NonceCheckStrict, 6); !errors.Is(err, ErrNonceTooHigh) {
+		t.Errorf("Checking strict with high nonce failed, got %v", err)
+		return
+	}
+	if result, err := run(NonceCheckStrict, 5); err != nil || result.W.NonceWrites[sender] != 6 {
+		t.Errorf("Checking strict failed, got %v", err)
+		return
+	}
+	if _, err := run(NonceCheckDeferred, 4); !errors.Is(err, ErrNonceTooLow) {
+		t.Errorf("Checking deferred with low nonce failed, got %v", err)
+		return
+	}
+	result, err := run(NonceCheckDeferred, 7)
+	if err != nil || result.R.NonceReads[sender] != 7 || result.W.NonceWrites[sender] != 8 {
+		t.Errorf("Checking deferred with high nonce failed, got %v", err)
+		return
+	}
+}
+
+func TestContractAddress(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+				nonce:   5,
+			},
+		},
+		codes:    map[string][]byte{},
+		storages: map[string]map[string]string{},
+	}
+
+	// The address follows the nonce the creation has used, not the one of
+	// the message.
+	for _, test := range []struct {
+		mode  NonceCheck
+		nonce uint64
+		used  uint64
+	}{
+		{NonceCheckSkip, 3, 5},
+		{NonceCheckDeferred, 7, 7},
+	} {
+		cfg := newTestConfig()
+		cfg.NonceCheck = test.mode
+		kapi := newMockKernelAPI()
+		eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+		msg := types.NewMessage(sender, nil, test.nonce, new(big.Int), 100000, new(big.Int).SetInt64(1), nil, nil, true)
+		_, receipt, err := eu.Run(common.Hash{}, &msg, *cfg.Coinbase)
+		if err != nil || receipt.ContractAddress != crypto.CreateAddress(sender, test.used) {
+			t.Errorf("Checking contract address with nonce %d failed, got %v", test.nonce, err)
+			return
+		}
+	}
+}
+
+func TestSetBlockContext(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	shifter := common.BytesToAddress([]byte("shifter"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+			string(shifter.Bytes()): &mockEthAccount{
+				balance: new(big.Int),
+			},
+		},
+		codes: map[string][]byte{
+			// sstore(0, shl(1, 1)), SHL is only valid from Constantinople.
+			string(shifter.Bytes()): common.Hex2Bytes("600160011b600055"),
+		},
+		storages: map[string]map[string]string{},
+	}
+
+	chainConfig := *params.TestChainConfig
+	chainConfig.ConstantinopleBlock = big.NewInt(5)
+	chainConfig.IstanbulBlock = nil
+	chainConfig.BerlinBlock = nil
+	cfg := newTestConfig()
+	cfg.ChainConfig = &chainConfig
+
+	kapi := newMockKernelAPI()
+	eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+	for _, test := range []struct {
+		number int64
+		status uint64
+	}{
+		{4, types.ReceiptStatusFailed},
+		{5, types.ReceiptStatusSuccessful},
+		{4, types.ReceiptStatusFailed},
+	} {
+		cfg.BlockNumber = big.NewInt(test.number)
+		eu.SetBlockContext(cfg)
+		if eu.evm.BlockNumber.Int64() != test.number {
+			t.Errorf("Checking block number %d failed", test.number)
+			return
+		}
+
+		msg := newTestMessager(sender, &shifter, 0, 0, nil)
+		_, receipt, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+		if err != nil || receipt.Status != test.status {
+			t.Errorf("Checking status at block %d failed, got %v", test.number, err)
+			return
+		}
+	}
+}
+
+func TestInstructionSets(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	contracts := []struct {
+		addr common.Address
+		code string
+		fork int64
+	}{
+		{common.BytesToAddress([]byte("delegatecall")), "600060006000600060006000f450", 2}, // DELEGATECALL
+		{common.BytesToAddress([]byte("returndatasize")), "3d50", 4},                       // RETURNDATASIZE
+		{common.BytesToAddress([]byte("shl")), "600160011b50", 6},                          // SHL
+	}
+
+	chainConfig := *params.TestChainConfig
+	chainConfig.HomesteadBlock = big.NewInt(2)
+	chainConfig.ByzantiumBlock = big.NewInt(4)
+	chainConfig.ConstantinopleBlock = big.NewInt(6)
+	chainConfig.IstanbulBlock = nil
+	chainConfig.BerlinBlock = nil
+	cfg := newTestConfig()
+	cfg.ChainConfig = &chainConfig
+
+	for number := int64(1); number <= 6; number++ {
+		mock := &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(sender.Bytes()): &mockEthAccount{
+					balance: new(big.Int).SetInt64(1000000),
+				},
+			},
+			codes:    map[string][]byte{},
+			storages: map[string]map[string]string{},
+		}
+		for _, contract := range contracts {
+			mock.accounts[string(contract.addr.Bytes())] = &mockEthAccount{balance: new(big.Int)}
+			mock.codes[string(contract.addr.Bytes())] = common.Hex2Bytes(contract.code)
+		}
+
+		cfg.BlockNumber = big.NewInt(number)
+		kapi := newMockKernelAPI()
+		eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+		for i, contract := range contracts {
+			msg := newTestMessager(sender, &contract.addr, uint64(i), 0, nil)
+			_, receipt, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+			if err != nil || (receipt.Status == types.ReceiptStatusSuccessful) != (number >= contract.fork) {
+				t.Errorf("Checking %s at block %d failed, got %v", contract.code, number, err)
+				return
+			}
+		}
+	}
+}
+
+func TestIstanbul(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	// sstore(0, chainid()) sstore(1, selfbalance())
+	istanbul := common.BytesToAddress([]byte("istanbul"))
+	// sstore(0, 0)
+	noop := common.BytesToAddress([]byte("noop"))
+	// pop(sload(0))
+	loader := common.BytesToAddress([]byte("loader"))
+
+	chainConfig := *params.TestChainConfig
+	chainConfig.IstanbulBlock = big.NewInt(5)
+	chainConfig.BerlinBlock = nil
+	cfg := newTestConfig()
+	cfg.ChainConfig = &chainConfig
+
+	for _, test := range []struct {
+		number           int64
+		status           uint64
+		noopGas, loadGas uint64
+	}{
+		{4, types.ReceiptStatusFailed, params.TxGas + 6 + params.SstoreResetGas, params.TxGas + 5 + params.GasTableConstantinople.SLoad},
+		{5, types.ReceiptStatusSuccessful, params.TxGas + 6 + params.SstoreNoopGasEIP2200, params.TxGas + 5 + params.GasTableIstanbul.SLoad},
+	} {
+		mock := &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(sender.Bytes()):   &mockEthAccount{balance: new(big.Int).SetInt64(1000000)},
+				string(istanbul.Bytes()): &mockEthAccount{balance: new(big.Int).SetInt64(7)},
+				string(noop.Bytes()):     &mockEthAccount{balance: new(big.Int)},
+				string(loader.Bytes()):   &mockEthAccount{balance: new(big.Int)},
+			},
+			codes: map[string][]byte{
+				string(istanbul.Bytes()): common.Hex2Bytes("4660005547600155"),
+				string(noop.Bytes()):     common.Hex2Bytes("6000600055"),
+				string(loader.Bytes()):   common.Hex2Bytes("60005450"),
+			},
+			storages: map[string]map[string]string{},
+		}
+		cfg.BlockNumber = big.NewInt(test.number)
+		kapi := newMockKernelAPI()
+		eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+
+		msg := newTestMessager(sender, &istanbul, 0, 0, nil)
+		result, receipt, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+		if err != nil || receipt.Status != test.status {
+			t.Errorf("Checking status at block %d failed, got %v", test.number, err)
+			return
+		}
+		if storage := result.W.EthStorageWrites[istanbul]; test.status == types.ReceiptStatusSuccessful &&
+			(storage[common.Hash{}] != common.BigToHash(chainConfig.ChainID) || storage[common.BigToHash(common.Big1)] != common.BigToHash(big.NewInt(7))) {
+			t.Errorf("Checking CHAINID and SELFBALANCE failed, got %v", storage)
+			return
+		}
+
+		msg = newTestMessager(sender, &noop, 1, 0, nil)
+		if result, _, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase); err != nil || result.GasUsed != test.noopGas {
+			t.Errorf("Checking SSTORE gas at block %d failed, got %d", test.number, result.GasUsed)
+			return
+		}
+		msg = newTestMessager(sender, &loader, 2, 0, nil)
+		if result, _, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase); err != nil || result.GasUsed != test.loadGas {
+			t.Errorf("Checking SLOAD gas at block %d failed, got %d", test.number, result.GasUsed)
+			return
+		}
+	}
+
+	if gas, _ := IntrinsicGas([]byte{0, 1}, nil, false, true, true); gas != params.TxGas+params.TxDataZeroGas+params.TxDataNonZeroGasEIP2028 {
+		t.Errorf("Checking intrinsic gas failed, got %d", gas)
+		return
+	}
+}
+
+func TestPetersburg(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	// sstore(0, 0)
+	noop := common.BytesToAddress([]byte("noop"))
+
+	chainConfig := *params.TestChainConfig
+	chainConfig.PetersburgBlock = big.NewInt(5)
+	chainConfig.IstanbulBlock = nil
+	chainConfig.BerlinBlock = nil
+	cfg := newTestConfig()
+	cfg.ChainConfig = &chainConfig
+
+	for _, test := range []struct {
+		number int64
+		gas    uint64
+	}{
+		{4, params.TxGas + 6 + params.NetSstoreNoopGas},
+		{5, params.TxGas + 6 + params.SstoreResetGas},
+	} {
+		mock := &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(sender.Bytes()): &mockEthAccount{balance: new(big.Int).SetInt64(1000000)},
+				string(noop.Bytes()):   &mockEthAccount{balance: new(big.Int)},
+			},
+			codes: map[string][]byte{
+				string(noop.Bytes()): common.Hex2Bytes("6000600055"),
+			},
+			storages: map[string]map[string]string{},
+		}
+		cfg.BlockNumber = big.NewInt(test.number)
+		kapi := newMockKernelAPI()
+		eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+
+		msg := newTestMessager(sender, &noop, 0, 0, nil)
+		if result, _, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase); err != nil || result.GasUsed != test.gas {
+			t.Errorf("Checking SSTORE gas at block %d failed, got %d", test.number, result.GasUsed)
+			return
+		}
+	}
+}
+
+func TestBerlin(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	// pop(sload(0)) pop(sload(0))
+	loader := common.BytesToAddress([]byte("loader"))
+	// pop(balance(sender)) pop(balance(loader))
+	balances := common.BytesToAddress([]byte("balances"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()):   &mockEthAccount{balance: new(big.Int).SetInt64(1000000)},
+			string(loader.Bytes()):   &mockEthAccount{balance: new(big.Int)},
+			string(balances.Bytes()): &mockEthAccount{balance: new(big.Int)},
+		},
+		codes: map[string][]byte{
+			string(loader.Bytes()):   common.Hex2Bytes("6000545060005450"),
+			string(balances.Bytes()): common.Hex2Bytes("73" + common.Bytes2Hex(sender.Bytes()) + "315073" + common.Bytes2Hex(loader.Bytes()) + "3150"),
+		},
+		storages: map[string]map[string]string{},
+	}
+	kapi := newMockKernelAPI()
+	eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, newTestConfig())
+
+	for i, test := range []struct {
+		to         common.Address
+		accessList types.AccessList
+		gas        uint64
+	}{
+		{loader, nil, params.TxGas + 10 + params.ColdSloadCostEIP2929 + params.WarmStorageReadCostEIP2929},
+		{loader, types.AccessList{{Address: loader, StorageKeys: []common.Hash{{}}}},
+			params.TxGas + params.TxAccessListAddressGas + params.TxAccessListStorageKeyGas + 10 + 2*params.WarmStorageReadCostEIP2929},
+		{balances, nil, params.TxGas + 10 + params.WarmStorageReadCostEIP2929 + params.ColdAccountAccessCostEIP2929},
+		{balances, types.AccessList{{Address: loader}}, params.TxGas + params.TxAccessListAddressGas + 10 + 2*params.WarmStorageReadCostEIP2929},
+	} {
+		msg := types.NewMessage(sender, &test.to, uint64(i), new(big.Int), 100000, new(big.Int).SetInt64(1), nil, test.accessList, false)
+		result, receipt, err := eu.Run(common.BytesToHash([]byte{byte(i)}), &msg, *newTestConfig().Coinbase)
+		if err != nil || receipt.Status != types.ReceiptStatusSuccessful || result.GasUsed != test.gas {
+			t.Errorf("Checking gas of message %d failed, got %d", i, result.GasUsed)
+			return
+		}
+	}
+}
+
+type meteredKernelAPI struct {
+	mockKernelAPI
+	addr common.Address
+	cost uint64
+}
+
+func (mock *meteredKernelAPI) IsKernelAPI(addr common.Address) bool {
+	return addr == mock.addr
+}
+
+func (mock *meteredKernelAPI) Call(call *vm.KernelCall) ([]byte, uint64, bool) {
+	return nil, mock.cost, true
+}
+
+func TestKernelAPIGas(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	api := common.BytesToAddress([]byte{0x80})
+	cfg := newTestConfig()
+
+	for _, test := range []struct {
+		cost    uint64
+		status  uint64
+		gasUsed uint64
+	}{
+		{5000, types.ReceiptStatusSuccessful, params.TxGas + 5000},
+		{100000, types.ReceiptStatusFailed, 100000},
+	} {
+		mock := &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(sender.Bytes()): &mockEthAccount{
+					balance: new(big.Int).SetInt64(1000000),
+				},
+			},
+		}
+		kapi := &meteredKernelAPI{addr: api, cost: test.cost}
+		eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+		msg := newTestMessager(sender, &api, 0, 0, nil)
+		result, receipt, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+		if err != nil || receipt.Status != test.status || receipt.GasUsed != test.gasUsed {
+			t.Errorf("Checking kernel API costing %d failed, got %v", test.cost, err)
+			return
+		}
+		if test.status == types.ReceiptStatusFailed && result.Err != vm.ErrOutOfGas {
+			t.Errorf("Checking out of gas failed, got %v", result.Err)
+			return
+		}
+	}
+}
+
+type collectingKernelAPI struct {
+	meteredKernelAPI
+}
+
+func (mock *collectingKernelAPI) Collect() ([]string, []string) {
+	return []string{"users"}, []string{"users/0"}
+}
+
+func TestKernelAPICollect(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	api := common.BytesToAddress([]byte{0x80})
+	cfg := newTestConfig()
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+		},
+	}
+	kapi := &collectingKernelAPI{meteredKernelAPI{addr: api}}
+	eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+	msg := newTestMessager(sender, &api, 0, 0, nil)
+	result, _, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+	if err != nil || len(result.R.ClibReads) != 1 || len(result.W.ClibWrites) != 1 || result.W.ClibWrites[0] != "users/0" {
+		t.Errorf("Checking kernel API accesses failed, got %v", err)
+		return
+	}
+}
+
+type recordingKernelAPI struct {
+	meteredKernelAPI
+	calls []*vm.KernelCall
+}
+
+func (mock *recordingKernelAPI) Call(call *vm.KernelCall) ([]byte, uint64, bool) {
+	mock.calls = append(mock.calls, call)
+	return nil, 0, true
+}
+
+func TestKernelAPICallTypes(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	contract := common.BytesToAddress([]byte("contract"))
+	api := common.BytesToAddress([]byte{0x80})
+	cfg := newTestConfig()
+
+	for _, test := range []struct {
+		code     string
+		callType vm.OpCode
+		caller   common.Address
+		address  common.Address
+		value    int64
+		readOnly bool
+	}{
+		// call(gas, 0x80, 5, 0, 0, 0, 0)
+		{"600060006000600060056080" + "5af100", vm.CALL, contract, api, 5, false},
+		// callcode(gas, 0x80, 5, 0, 0, 0, 0)
+		{"600060006000600060056080" + "5af200", vm.CALLCODE, contract, contract, 5, false},
+		// delegatecall(gas, 0x80, 0, 0, 0, 0)
+		{"6000600060006000" + "6080" + "5af400", vm.DELEGATECALL, sender, contract, 7, false},
+		// staticcall(gas, 0x80, 0, 0, 0, 0)
+		{"6000600060006000" + "6080" + "5afa00", vm.STATICCALL, contract, api, 0, true},
+	} {
+		mock := &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(sender.Bytes()): &mockEthAccount{
+					balance: new(big.Int).SetInt64(1000000),
+				},
+				string(contract.Bytes()): &mockEthAccount{
+					balance: new(big.Int).SetInt64(100),
+				},
+			},
+			codes: map[string][]byte{
+				string(contract.Bytes()): common.Hex2Bytes(test.code),
+			},
+		}
+		kapi := &recordingKernelAPI{meteredKernelAPI: meteredKernelAPI{addr: api}}
+		eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+		msg := newTestMessager(sender, &contract, 0, 7, nil)
+		result, _, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+		if err != nil || result.Status != types.ReceiptStatusSuccessful || len(kapi.calls) != 1 {
+			t.Errorf("Checking %v failed, got %v", test.callType, err)
+			return
+		}
+		call := kapi.calls[0]
+		if call.Type != test.callType ||
+			call.Caller != test.caller ||
+			call.Address != test.address ||
+			call.Callee != api ||
+			call.Value.Int64() != test.value ||
+			call.ReadOnly != test.readOnly ||
+			call.Origin != sender {
+			t.Errorf("Checking call of %v failed, got %+v", test.callType, call)
+			return
+		}
+
+		transferred := test.callType == vm.CALL
+		if _, ok := result.W.BalanceWrites[api]; ok != transferred {
+			t.Errorf("Checking value transfer of %v failed", test.callType)
+			return
+		}
+	}
+}
+
+// journalingKernelAPI appends the first byte of the input of every call to
+// values, its snapshots undo the appends.
+type journalingKernelAPI struct {
+	meteredKernelAPI
+	values []byte
+}
+
+func (mock *journalingKernelAPI) Call(call *vm.KernelCall) ([]byte, uint64, bool) {
+	mock.values = append(mock.values, call.Input[0])
+	return nil, 0, true
+}
+
+func (mock *journalingKernelAPI) Snapshot() int {
+	return len(mock.values)
+}
+
+func (mock *journalingKernelAPI) RevertToSnapshot(id int) {
+	mock.values = mock.values[:id]
+}
+
+func TestKernelAPIRevert(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	api := common.BytesToAddress([]byte{0x80})
+	committer := common.BytesToAddress([]byte("committer"))
+	reverter := common.BytesToAddress([]byte("reverter"))
+	cfg := newTestConfig()
+
+	// Both call the kernel API with 0x01 as input, the reverter reverts
+	// afterwards.
+	call := "600160005360006000600160006000608061fffff150"
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+		},
+		codes: map[string][]byte{
+			string(committer.Bytes()): common.Hex2Bytes(call + "00"),
+			string(reverter.Bytes()):  common.Hex2Bytes(call + "60006000fd"),
+		},
+	}
+	kapi := &journalingKernelAPI{meteredKernelAPI: meteredKernelAPI{addr: api}}
+	eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+
+	for i, test := range []struct {
+		to     common.Address
+		status uint64
+		values []byte
+	}{
+		{committer, types.ReceiptStatusSuccessful, []byte{1}},
+		{reverter, types.ReceiptStatusFailed, []byte{1}},
+	} {
+		msg := newTestMessager(sender, &test.to, uint64(i), 0, nil)
+		_, receipt, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+		if err != nil || receipt.Status != test.status || !bytes.Equal(kapi.values, test.values) {
+			t.Errorf("Checking kernel API writes of %d failed, got %x", i, kapi.values)
+			return
+		}
+	}
+}
+
+type stubKernelAPI struct {
+	meteredKernelAPI
+	code []byte
+}
+
+func (mock *stubKernelAPI) Code(addr common.Address) []byte {
+	if addr == mock.addr {
+		return mock.code
+	}
+	return nil
+}
+
+func TestKernelAPICode(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	contract := common.BytesToAddress([]byte("contract"))
+	api := common.BytesToAddress([]byte{0x80})
+	cfg := newTestConfig()
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+			string(contract.Bytes()): &mockEthAccount{
+				balance: new(big.Int),
+			},
+		},
+		codes: map[string][]byte{
+			// sstore(0, extcodesize(0x80)) sstore(1, extcodehash(0x80))
+			string(contract.Bytes()): common.Hex2Bytes("60803b60005560803f60015500"),
+		},
+		storages: map[string]map[string]string{},
+	}
+	kapi := &stubKernelAPI{meteredKernelAPI: meteredKernelAPI{addr: api}, code: common.Hex2Bytes("600080fd")}
+	eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+	msg := newTestMessager(sender, &contract, 0, 0, nil)
+	result, _, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+	if err != nil || result.Status != types.ReceiptStatusSuccessful {
+		t.Errorf("Checking execution failed, got %v", err)
+		return
+	}
+	storage := result.W.EthStorageWrites[contract]
+	if storage[common.BigToHash(big.NewInt(0))] != common.BigToHash(big.NewInt(4)) ||
+		storage[common.BigToHash(big.NewInt(1))] != crypto.Keccak256Hash(kapi.code) {
+		t.Errorf("Checking code of kernel API failed, got %v", storage)
+		return
+	}
+	if _, ok := result.R.CodeReads[api]; ok {
+		t.Error("Checking code reads failed")
+		return
+	}
+}
+
+func TestPrecompiles(t *testing.T) {
+	key := newTestKey(1)
+	sender := common.BytesToAddress(crypto.Keccak256(elliptic.Marshal(key.Curve, key.X, key.Y)[1:])[12:])
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(10000000),
+			},
+		},
+		storages: map[string]map[string]string{},
+	}
+
+	chainConfig := *params.TestChainConfig
+	chainConfig.IstanbulBlock = big.NewInt(5)
+	chainConfig.BerlinBlock = nil
+	cfg := newTestConfig()
+	cfg.ChainConfig = &chainConfig
+	cfg.BlockNumber = big.NewInt(5)
+
+	kapi := newMockKernelAPI()
+	eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+	var nonce uint64
+	call := func(precompile byte, input []byte) *types.EuResult {
+		to := common.BytesToAddress([]byte{precompile})
+		msg := newTestMessager(sender, &to, nonce, 0, input)
+		nonce++
+		result, receipt, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+		if err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+			return nil
+		}
+		return result
+	}
+
+	hash := crypto.Keccak256([]byte("message"))
+	sig, _ := crypto.Sign(hash, key)
+	input := append(common.CopyBytes(hash), common.LeftPadBytes([]byte{sig[64] + 27}, 32)...)
+	input = append(input, sig[:64]...)
+	if result := call(1, input); result == nil || !bytes.Equal(result.ReturnData, common.LeftPadBytes(sender.Bytes(), 32)) {
+		t.Error("Checking ecrecover failed")
+		return
+	}
+
+	expected := sha256.Sum256([]byte("abc"))
+	if result := call(2, []byte("abc")); result == nil || !bytes.Equal(result.ReturnData, expected[:]) ||
+		result.GasUsed != params.TxGas+3*params.TxDataNonZeroGasEIP2028+params.Sha256BaseGas+params.Sha256PerWordGas {
+		t.Error("Checking sha256 failed")
+		return
+	}
+
+	// (1, 2) + (1, 2)
+	g := common.Hex2Bytes("00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002")
+	if result := call(6, append(g, g...)); result == nil || !bytes.Equal(result.ReturnData, common.Hex2Bytes("030644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd315ed738c0e0a7c92e7845f96b2ae9c0a68a6a449e3538fc7ff3ebf7a5a18a2c4")) {
+		t.Error("Checking bn256Add failed")
+		return
+	}
+
+	// BLAKE2b-512 of "abc" as a single compression.
+	input = make([]byte, 213)
+	binary.BigEndian.PutUint32(input, 12)
+	for i, v := range blake2b.IV {
+		if i == 0 {
+			v ^= 0x01010040
+		}
+		binary.LittleEndian.PutUint64(input[4+8*i:], v)
+	}
+	copy(input[68:], "abc")
+	input[196], input[212] = 3, 1
+	sum := xblake2b.Sum512([]byte("abc"))
+	if result := call(9, input); result == nil || !bytes.Equal(result.ReturnData, sum[:]) {
+		t.Error("Checking blake2F failed")
+		return
+	}
+
+	// Not a precompiled contract before Istanbul.
+	cfg.BlockNumber = big.NewInt(4)
+	eu.SetBlockContext(cfg)
+	if result := call(9, input); result == nil || len(result.ReturnData) != 0 {
+		t.Error("Checking blake2F before Istanbul failed")
+		return
+	}
+}
+
+// reverser is a custom pre-compiled contract returning its input reversed.
+type reverser struct{}
+
+func (c *reverser) RequiredGas(input []byte) uint64 {
+	return 100
+}
+
+func (c *reverser) Run(input []byte) ([]byte, error) {
+	ret := make([]byte, len(input))
+	for i, b := range input {
+		ret[len(input)-1-i] = b
+	}
+	return ret, nil
+}
+
+func TestCustomPrecompiles(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	custom := common.BytesToAddress([]byte{1, 0})
+	identity := common.BytesToAddress([]byte{4})
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+		},
+		storages: map[string]map[string]string{},
+	}
+	cfg := newTestConfig()
+	cfg.VMConfig.Precompiles = map[common.Address]vm.PrecompiledContract{
+		custom: &reverser{},
+	}
+
+	kapi := newMockKernelAPI()
+	eu := NewEU(0, NewStateDB(mock, mock, kapi), kapi, cfg)
+
+	msg := newTestMessager(sender, &custom, 0, 0, []byte{1, 2, 3})
+	result, _, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+	if err != nil || !bytes.Equal(result.ReturnData, []byte{3, 2, 1}) || result.GasUsed != params.TxGas+3*params.TxDataNonZeroGasEIP2028+100 {
+		t.Errorf("Checking custom precompile failed, got %v", err)
+		return
+	}
+
+	msg = newTestMessager(sender, &identity, 1, 0, []byte{1, 2, 3})
+	result, _, err = eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+	if err != nil || !bytes.Equal(result.ReturnData, []byte{1, 2, 3}) {
+		t.Errorf("Checking default precompile failed, got %v", err)
+		return
+	}
+}
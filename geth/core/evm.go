@@ -2,6 +2,7 @@ package core
 
 import (
 	"math/big"
+	"sync"
 
 	"github.com/HPISTechnologies/mevm/geth/common"
 	"github.com/HPISTechnologies/mevm/geth/core/types"
@@ -12,7 +13,7 @@ import (
 // ChainContext supports retrieving headers and consensus parameters from the
 // current blockchain to be used during transaction processing.
 type ChainContext interface {
-	// GetHeader returns the hash corresponding to their hash.
+	// GetHeader returns the header corresponding to the hash and number.
 	GetHeader(common.Hash, uint64) *types.Header
 }
 
@@ -27,8 +28,25 @@ type Config struct {
 	Coinbase    *common.Address
 	GasLimit    uint64   // types.Header.GasLimit
 	Difficulty  *big.Int // types.Header.Difficulty
+	NonceCheck  NonceCheck
 }
 
+// NonceCheck selects how the nonce of a message is validated.
+type NonceCheck uint8
+
+const (
+	// NonceCheckSkip doesn't validate nonces.
+	NonceCheckSkip NonceCheck = iota
+	// NonceCheckStrict rejects a message whose nonce isn't the nonce of the
+	// sender in the state the EU runs against.
+	NonceCheckStrict
+	// NonceCheckDeferred only rejects a message whose nonce is lower than the
+	// nonce of the sender, which is a replay. Otherwise the message is executed
+	// with its own nonce, which is recorded as the nonce read of the sender, so
+	// the arbitrator can check it against the transactions before it.
+	NonceCheckDeferred
+)
+
 // NewEVMContext creates a new context for use in the EVM.
 func NewEVMContext(cfg *Config) vm.Context {
 	return vm.Context{
@@ -50,28 +68,49 @@ func ResetEVMContext(context vm.Context, msg types.Message) vm.Context {
 	return context
 }
 
-// GetHashFn returns a GetHashFunc which retrieves header hashes by number
+// GetHashFn returns a GetHashFunc which retrieves header hashes by number.
+// The hashes are cached, the function is safe for concurrent use so the EUs
+// running a block can share it.
 func GetHashFn(blockNumber *big.Int, parentHash common.Hash, chain ChainContext) func(n uint64) common.Hash {
-	// var cache map[uint64]common.Hash
+	var (
+		number = blockNumber.Uint64()
+		mu     sync.Mutex
+		cache  []common.Hash // cache[i] is the hash of block number-1-i
+	)
 
 	return func(n uint64) common.Hash {
+		if n >= number {
+			return common.Hash{}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
 		// If there's no hash cache yet, make one
-		// if cache == nil {
-		// 	cache = map[uint64]common.Hash{
-		// 		blockNumber.Uint64() - 1: parentHash,
-		// 	}
-		// }
-		// // Try to fulfill the request from the cache
-		// if hash, ok := cache[n]; ok {
-		// 	return hash
-		// }
-		// // Not cached, iterate the blocks and cache the hashes
-		// for header := chain.GetHeader(parentHash, blockNumber.Uint64()-1); header != nil; header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1) {
-		// 	cache[header.Number.Uint64()-1] = header.ParentHash
-		// 	if n == header.Number.Uint64()-1 {
-		// 		return header.ParentHash
-		// 	}
-		// }
+		if len(cache) == 0 {
+			cache = append(cache, parentHash)
+		}
+		// Try to fulfill the request from the cache
+		if idx := number - n - 1; idx < uint64(len(cache)) {
+			return cache[idx]
+		}
+		if chain == nil {
+			return common.Hash{}
+		}
+		// Not cached, iterate the blocks from the last known one and cache the hashes
+		lastKnownHash := cache[len(cache)-1]
+		lastKnownNumber := number - uint64(len(cache))
+		for lastKnownNumber > 0 {
+			header := chain.GetHeader(lastKnownHash, lastKnownNumber)
+			if header == nil {
+				break
+			}
+			lastKnownHash, lastKnownNumber = header.ParentHash, lastKnownNumber-1
+			cache = append(cache, lastKnownHash)
+			if n == lastKnownNumber {
+				return lastKnownHash
+			}
+		}
 		return common.Hash{}
 	}
 }
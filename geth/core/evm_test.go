@@ -0,0 +1,89 @@
+package core
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+)
+
+func newTestChain(n int) []*types.Header {
+	var headers []*types.Header
+	parentHash := common.Hash{}
+	for i := 0; i < n; i++ {
+		header := &types.Header{
+			ParentHash: parentHash,
+			Number:     big.NewInt(int64(i)),
+			Time:       big.NewInt(int64(i)),
+			Difficulty: big.NewInt(1),
+		}
+		headers = append(headers, header)
+		parentHash = header.Hash()
+	}
+	return headers
+}
+
+func TestGetHashFn(t *testing.T) {
+	headers := newTestChain(6)
+	getHash := GetHashFn(big.NewInt(6), headers[5].Hash(), NewMemoryChain(headers...))
+
+	var wg sync.WaitGroup
+	for k := 0; k < 4; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := len(headers) - 1; i >= 0; i-- {
+				if getHash(uint64(i)) != headers[i].Hash() {
+					t.Errorf("Checking hash of block %d failed", i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if getHash(6) != (common.Hash{}) || getHash(7) != (common.Hash{}) {
+		t.Error("Checking hash of future block failed")
+		return
+	}
+
+	getHash = GetHashFn(big.NewInt(6), headers[5].Hash(), nil)
+	if getHash(5) != headers[5].Hash() || getHash(4) != (common.Hash{}) {
+		t.Error("Checking hash without chain failed")
+		return
+	}
+}
+
+func TestBlockhash(t *testing.T) {
+	headers := newTestChain(6)
+	sender := common.BytesToAddress([]byte{1})
+	contract := common.BytesToAddress([]byte("contract"))
+	// Stores the hash of block 1 in slot 0.
+	code := common.Hex2Bytes("600140600055")
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+			string(contract.Bytes()): &mockEthAccount{
+				balance: new(big.Int),
+			},
+		},
+		codes: map[string][]byte{
+			string(contract.Bytes()): code,
+		},
+		storages: map[string]map[string]string{},
+	}
+
+	cfg := newTestConfig()
+	cfg.BlockNumber = big.NewInt(6)
+	cfg.ParentHash = headers[5].Hash()
+	cfg.Chain = NewMemoryChain(headers...)
+	results, _, errs := NewParallelExecutor(cfg, 2, newMockKernelAPI).Run(mock, mock, []*types.Messager{newTestMessager(sender, &contract, 0, 0, nil)})
+	if errs[0] != nil || results[0].W.EthStorageWrites[contract][common.Hash{}] != headers[1].Hash() {
+		t.Error("Checking blockhash failed")
+		return
+	}
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+)
+
+// ParallelExecutor drives a pool of EUs. Every EU owns its StateDB and
+// KernelAPI, the messages of a block are spread over the EUs and executed
+// concurrently against the same account and storage caches.
+type ParallelExecutor struct {
+	cfg *Config
+	eus []*EU
+}
+
+// NewParallelExecutor creates an executor with numEUs EUs. newKernelAPI is
+// called once for each EU, so EUs never share a KernelAPI instance.
+func NewParallelExecutor(cfg *Config, numEUs int, newKernelAPI func() KernelAPI) *ParallelExecutor {
+	if numEUs < 1 {
+		numEUs = 1
+	}
+
+	eus := make([]*EU, numEUs)
+	for i := range eus {
+		kapi := newKernelAPI()
+		eus[i] = NewEU(uint16(i), NewStateDB(nil, nil, kapi), kapi, cfg)
+	}
+	pe := &ParallelExecutor{
+		eus: eus,
+	}
+	pe.SetConfig(cfg)
+	return pe
+}
+
+// SetConfig moves the EUs to the block described by cfg, which allows the
+// executor to be kept across blocks.
+func (pe *ParallelExecutor) SetConfig(cfg *Config) {
+	// The EUs share the block hash cache.
+	getHash := GetHashFn(cfg.BlockNumber, cfg.ParentHash, cfg.Chain)
+	for _, eu := range pe.eus {
+		eu.SetBlockContext(cfg)
+		eu.evm.Context.GetHash = getHash
+	}
+	pe.cfg = cfg
+}
+
+// Run executes msgs against eac and esc. The results, receipts and errors are
+// returned in the order of msgs, whichever EU executed them. An invalid message
+// has a nil result and receipt, and its error is set. As with a GasPool of
+// cfg.GasLimit, a message is rejected with ErrGasLimitReached if its gas
+// doesn't fit in what the messages before it in msgs have left.
+func (pe *ParallelExecutor) Run(eac EthAccountCache, esc EthStorageCache, msgs []*types.Messager) ([]*types.EuResult, []*types.Receipt, []error) {
+	results := make([]*types.EuResult, len(msgs))
+	receipts := make([]*types.Receipt, len(msgs))
+	errs := make([]error, len(msgs))
+	pe.execute(len(msgs), func(eu *EU, i int) {
+		eu.SetApc(eac, esc)
+		results[i], receipts[i], errs[i] = eu.Run(msgs[i].Txhash, msgs[i].Msg, *pe.cfg.Coinbase)
+	})
+
+	// The gas limit is applied in the order of msgs once all of them are
+	// executed, whichever EU finished first.
+	remaining := pe.cfg.GasLimit
+	for i := range msgs {
+		if errs[i] != nil {
+			continue
+		}
+		if msgs[i].Msg.Gas() > remaining {
+			results[i], receipts[i] = nil, nil
+			errs[i] = &InvalidTransactionError{Hash: msgs[i].Txhash, Err: ErrGasLimitReached}
+			continue
+		}
+		remaining -= results[i].GasUsed
+	}
+	return results, receipts, errs
+}
+
+// execute calls run for every index in [0, n) on the EU pool. Each EU handles
+// one index at a time, execute returns after all of them are done.
+func (pe *ParallelExecutor) execute(n int, run func(eu *EU, i int)) {
+	jobs := make(chan int, n)
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	for _, eu := range pe.eus {
+		wg.Add(1)
+		go func(eu *EU) {
+			defer wg.Done()
+			for i := range jobs {
+				run(eu, i)
+			}
+		}(eu)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,231 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+	"github.com/HPISTechnologies/mevm/geth/core/vm"
+	"github.com/HPISTechnologies/mevm/geth/params"
+)
+
+type mockKernelAPI struct{}
+
+func (mock *mockKernelAPI) IsKernelAPI(addr common.Address) bool {
+	return false
+}
+
+func (mock *mockKernelAPI) Prepare(thash common.Hash) {}
+
+func (mock *mockKernelAPI) Call(call *vm.KernelCall) ([]byte, uint64, bool) {
+	return nil, 0, true
+}
+
+func (mock *mockKernelAPI) Code(addr common.Address) []byte {
+	return nil
+}
+
+func newMockKernelAPI() KernelAPI {
+	return &mockKernelAPI{}
+}
+
+func newTestConfig() *Config {
+	coinbase := common.BytesToAddress([]byte("coinbase"))
+	return &Config{
+		ChainConfig: params.TestChainConfig,
+		VMConfig:    &vm.Config{},
+		BlockNumber: new(big.Int).SetUint64(1),
+		ParentHash:  common.Hash{},
+		Time:        new(big.Int).SetUint64(1),
+		Coinbase:    &coinbase,
+		GasLimit:    10000000,
+		Difficulty:  new(big.Int).SetUint64(1),
+	}
+}
+
+func newTestMessager(from common.Address, to *common.Address, nonce uint64, amount int64, data []byte) *types.Messager {
+	msg := types.NewMessage(from, to, nonce, new(big.Int).SetInt64(amount), 100000, new(big.Int).SetInt64(1), data, nil, false)
+	return &types.Messager{
+		Txhash: common.BytesToHash(append(from.Bytes(), byte(nonce))),
+		Msg:    &msg,
+	}
+}
+
+func TestParallelExecutor(t *testing.T) {
+	senders := []common.Address{
+		common.BytesToAddress([]byte{1}),
+		common.BytesToAddress([]byte{2}),
+		common.BytesToAddress([]byte{3}),
+		common.BytesToAddress([]byte{4}),
+	}
+	receiver := common.BytesToAddress([]byte("receiver"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(receiver.Bytes()): &mockEthAccount{
+				balance: new(big.Int),
+			},
+		},
+	}
+	var msgs []*types.Messager
+	for _, sender := range senders {
+		mock.accounts[string(sender.Bytes())] = &mockEthAccount{
+			balance: new(big.Int).SetInt64(1000000),
+		}
+		msgs = append(msgs, newTestMessager(sender, &receiver, 0, 1, nil))
+	}
+
+	executor := NewParallelExecutor(newTestConfig(), 2, newMockKernelAPI)
+	results, receipts, errs := executor.Run(mock, mock, msgs)
+	if len(results) != len(msgs) || len(receipts) != len(msgs) || len(errs) != len(msgs) {
+		t.Error("Checking result count failed")
+		return
+	}
+	for i, msg := range msgs {
+		if errs[i] != nil || results[i].H != msg.Txhash || receipts[i].TxHash != msg.Txhash {
+			t.Errorf("Checking order of result %d failed", i)
+			return
+		}
+		if receipts[i].Status != types.ReceiptStatusSuccessful || receipts[i].GasUsed != params.TxGas {
+			t.Errorf("Checking receipt %d failed", i)
+			return
+		}
+		if results[i].W.BalanceWrites[receiver].Cmp(new(big.Int).SetInt64(1)) != 0 ||
+			results[i].W.BalanceWrites[msg.Msg.From()].Cmp(new(big.Int).SetInt64(-int64(params.TxGas)-1)) != 0 {
+			t.Errorf("Checking balance writes of result %d failed", i)
+			return
+		}
+	}
+}
+
+func TestParallelExecutorGasLimit(t *testing.T) {
+	senders := []common.Address{
+		common.BytesToAddress([]byte{1}),
+		common.BytesToAddress([]byte{2}),
+		common.BytesToAddress([]byte{3}),
+		common.BytesToAddress([]byte{4}),
+	}
+	receiver := common.BytesToAddress([]byte("receiver"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{},
+	}
+	var msgs []*types.Messager
+	for _, sender := range senders {
+		mock.accounts[string(sender.Bytes())] = &mockEthAccount{
+			balance: new(big.Int).SetInt64(1000000),
+		}
+		msgs = append(msgs, newTestMessager(sender, &receiver, 0, 1, nil))
+	}
+
+	// Every message reserves 100000 and uses 21000, the last one doesn't fit.
+	cfg := newTestConfig()
+	cfg.GasLimit = 100000 + 2*params.TxGas
+	executor := NewParallelExecutor(cfg, 1, newMockKernelAPI)
+	results, receipts, errs := executor.Run(mock, mock, msgs)
+	for i := 0; i < 3; i++ {
+		if errs[i] != nil || receipts[i].Status != types.ReceiptStatusSuccessful {
+			t.Errorf("Checking message %d failed, got %v", i, errs[i])
+			return
+		}
+	}
+	if results[3] != nil || receipts[3] != nil || !errors.Is(errs[3], ErrGasLimitReached) {
+		t.Errorf("Checking gas limit failed, got %v", errs[3])
+		return
+	}
+}
+
+// gatedKernelAPI starts the execution of second once first is calling the
+// kernel API, the call of first waits until second has been executed.
+type gatedKernelAPI struct {
+	mockKernelAPI
+	addr          common.Address
+	first, second common.Hash
+	calling, done chan struct{}
+	thash         common.Hash
+}
+
+func (mock *gatedKernelAPI) IsKernelAPI(addr common.Address) bool {
+	return addr == mock.addr
+}
+
+func (mock *gatedKernelAPI) Prepare(thash common.Hash) {
+	mock.thash = thash
+	if thash == mock.second {
+		<-mock.calling
+	}
+}
+
+func (mock *gatedKernelAPI) Call(call *vm.KernelCall) ([]byte, uint64, bool) {
+	if mock.thash == mock.first {
+		close(mock.calling)
+		select {
+		case <-mock.done:
+		case <-time.After(time.Second):
+		}
+	}
+	return nil, 0, true
+}
+
+func (mock *gatedKernelAPI) Collect() ([]string, []string) {
+	if mock.thash == mock.second {
+		close(mock.done)
+	}
+	return nil, nil
+}
+
+func TestParallelExecutorGasOrder(t *testing.T) {
+	caller := common.BytesToAddress([]byte{1})
+	sender := common.BytesToAddress([]byte{2})
+	contract := common.BytesToAddress([]byte("contract"))
+	receiver := common.BytesToAddress([]byte("receiver"))
+	api := common.BytesToAddress([]byte{0x80})
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(caller.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+			string(sender.Bytes()): &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			},
+			string(contract.Bytes()): &mockEthAccount{
+				balance: new(big.Int),
+			},
+		},
+		codes: map[string][]byte{
+			// call(gas, 0x80, 0, 0, 0, 0, 0)
+			string(contract.Bytes()): common.Hex2Bytes("600060006000600060006080" + "5af100"),
+		},
+	}
+	msgs := []*types.Messager{
+		newTestMessager(caller, &contract, 0, 0, nil),
+		newTestMessager(sender, &receiver, 0, 1, nil),
+	}
+
+	// The second message is executed while the first one is running. Both
+	// reserve 100000, the first one uses much less and the second one fits
+	// in what it has left.
+	cfg := newTestConfig()
+	cfg.GasLimit = 150000
+	calling, done := make(chan struct{}), make(chan struct{})
+	executor := NewParallelExecutor(cfg, 2, func() KernelAPI {
+		return &gatedKernelAPI{
+			addr:    api,
+			first:   msgs[0].Txhash,
+			second:  msgs[1].Txhash,
+			calling: calling,
+			done:    done,
+		}
+	})
+	_, receipts, errs := executor.Run(mock, mock, msgs)
+	for i := range msgs {
+		if errs[i] != nil || receipts[i].Status != types.ReceiptStatusSuccessful {
+			t.Errorf("Checking message %d failed, got %v", i, errs[i])
+			return
+		}
+	}
+}
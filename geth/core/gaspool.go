@@ -0,0 +1,55 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// GasPool tracks the amount of gas available during execution of the
+// transactions in a block. It is safe for concurrent use, so the EUs running a
+// block can share one pool.
+type GasPool struct {
+	gas uint64
+}
+
+// NewGasPool creates a GasPool holding gas.
+func NewGasPool(gas uint64) *GasPool {
+	return &GasPool{gas: gas}
+}
+
+// AddGas makes gas available for execution.
+func (gp *GasPool) AddGas(amount uint64) *GasPool {
+	for {
+		gas := atomic.LoadUint64(&gp.gas)
+		if gas > math.MaxUint64-amount {
+			panic("gas pool pushed above uint64")
+		}
+		if atomic.CompareAndSwapUint64(&gp.gas, gas, gas+amount) {
+			return gp
+		}
+	}
+}
+
+// SubGas deducts the given amount from the pool if enough gas is
+// available and returns an error otherwise.
+func (gp *GasPool) SubGas(amount uint64) error {
+	for {
+		gas := atomic.LoadUint64(&gp.gas)
+		if gas < amount {
+			return ErrGasLimitReached
+		}
+		if atomic.CompareAndSwapUint64(&gp.gas, gas, gas-amount) {
+			return nil
+		}
+	}
+}
+
+// Gas returns the amount of gas remaining in the pool.
+func (gp *GasPool) Gas() uint64 {
+	return atomic.LoadUint64(&gp.gas)
+}
+
+func (gp *GasPool) String() string {
+	return fmt.Sprintf("%d", gp.Gas())
+}
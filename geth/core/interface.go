@@ -5,6 +5,7 @@ import (
 
 	"github.com/HPISTechnologies/mevm/geth/common"
 	"github.com/HPISTechnologies/mevm/geth/core/types"
+	"github.com/HPISTechnologies/mevm/geth/core/vm"
 )
 
 type StateDB interface {
@@ -50,6 +51,12 @@ type StateDB interface {
 
 	ForEachStorage(common.Address, func(common.Hash, common.Hash) bool)
 
+	PrepareAccessList(sender common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList)
+	AddressInAccessList(addr common.Address) bool
+	SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool)
+	AddAddressToAccessList(addr common.Address)
+	AddSlotToAccessList(addr common.Address, slot common.Hash)
+
 	Prepare(thash, bhash common.Hash, ti int)
 	GetLogs(hash common.Hash) []*types.Log
 	Copy() StateDB
@@ -72,8 +79,34 @@ type EthStorageCache interface {
 	GetState(string, []byte) []byte
 }
 
+// KernelAPI is the kernel API of the EVM of an EU. Prepare is called with the
+// hash of the transaction before every execution, if the same transaction is
+// executed again the writes of the earlier execution must be dropped then. With
+// a Scheduler, the state of the kernel API is shared by the EUs, it is only
+// called by executions that are never discarded, in the order of the block.
 type KernelAPI interface {
 	IsKernelAPI(addr common.Address) bool
 	Prepare(thash common.Hash)
-	Call(caller, callee common.Address, input []byte, origin common.Address, nonce uint64, blockhash common.Hash) ([]byte, bool)
+	Call(call *vm.KernelCall) ([]byte, uint64, bool)
+	// Code returns the stub bytecode reported as the code of the kernel API
+	// at addr. It is never executed, calls are handled by Call.
+	Code(addr common.Address) []byte
+}
+
+// KernelAPIJournal is implemented by a KernelAPI able to undo the writes of its
+// calls. Its snapshots are taken and reverted along with the ones of the
+// StateDB, so the writes of a reverted call frame are dropped with its changes
+// to the Ethereum state.
+type KernelAPIJournal interface {
+	Snapshot() int
+	RevertToSnapshot(int)
+}
+
+// KernelAPICollector is implemented by a KernelAPI keeping track of the state
+// its calls access. The reads are attached to the EuResult of a transaction,
+// the writes only if it has succeeded, they are arbitrated like the accesses to
+// the Ethereum state.
+type KernelAPICollector interface {
+	// Collect returns the keys read and written since the last Prepare.
+	Collect() (reads, writes []string)
 }
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"math/big"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+)
+
+// journalEntry is a modification entry in the state change journal that can be
+// reverted on demand.
+type journalEntry interface {
+	// revert undoes the changes introduced by this journal entry.
+	revert(*ethState)
+}
+
+// journal contains the list of state modifications applied since the last
+// Prepare. These are tracked to be able to be reverted in case of an execution
+// exception or revertal request. Reads are not journaled, a reverted call
+// frame still depends on the state it has read.
+type journal struct {
+	entries []journalEntry
+}
+
+// newJournal creates a new initialized journal.
+func newJournal() *journal {
+	return &journal{}
+}
+
+// append inserts a new modification entry to the end of the change journal.
+func (j *journal) append(entry journalEntry) {
+	j.entries = append(j.entries, entry)
+}
+
+// revert undoes a batch of journalled modifications.
+func (j *journal) revert(es *ethState, snapshot int) {
+	for i := len(j.entries) - 1; i >= snapshot; i-- {
+		j.entries[i].revert(es)
+	}
+	j.entries = j.entries[:snapshot]
+}
+
+// length returns the current number of entries in the journal.
+func (j *journal) length() int {
+	return len(j.entries)
+}
+
+type (
+	// Changes to the account trie.
+	createAccountChange struct {
+		account *common.Address
+	}
+
+	// Changes to individual accounts. For the write sets, exists tells
+	// whether the account had an entry before the change.
+	balanceChange struct {
+		account *common.Address
+		prev    *big.Int
+		exists  bool
+	}
+	nonceChange struct {
+		account *common.Address
+		prev    uint64
+		exists  bool
+	}
+	codeChange struct {
+		account  *common.Address
+		prevcode []byte
+		exists   bool
+	}
+	suicideChange struct {
+		account *common.Address
+	}
+	storageChange struct {
+		account  *common.Address
+		key      common.Hash
+		prevalue common.Hash
+		exists   bool
+	}
+
+	// Changes to other state values.
+	refundChange struct {
+		prev uint64
+	}
+	addLogChange struct {
+		txhash common.Hash
+	}
+	kernelSnapshotChange struct {
+		id int
+	}
+
+	// Changes to the access list.
+	accessListAddAccountChange struct {
+		address *common.Address
+	}
+	accessListAddSlotChange struct {
+		address *common.Address
+		slot    common.Hash
+	}
+)
+
+func (ch createAccountChange) revert(es *ethState) {
+	delete(es.newlyCreated, *ch.account)
+}
+
+func (ch balanceChange) revert(es *ethState) {
+	if ch.exists {
+		es.balanceWrites[*ch.account] = ch.prev
+	} else {
+		delete(es.balanceWrites, *ch.account)
+	}
+}
+
+func (ch nonceChange) revert(es *ethState) {
+	if ch.exists {
+		es.nonceWrites[*ch.account] = ch.prev
+	} else {
+		delete(es.nonceWrites, *ch.account)
+	}
+}
+
+func (ch codeChange) revert(es *ethState) {
+	if ch.exists {
+		es.codeWrites[*ch.account] = ch.prevcode
+	} else {
+		delete(es.codeWrites, *ch.account)
+	}
+}
+
+func (ch suicideChange) revert(es *ethState) {
+	delete(es.suicided, *ch.account)
+}
+
+func (ch storageChange) revert(es *ethState) {
+	storage := es.storageWrites[*ch.account]
+	if ch.exists {
+		storage[ch.key] = ch.prevalue
+		return
+	}
+
+	delete(storage, ch.key)
+	if len(storage) == 0 {
+		delete(es.storageWrites, *ch.account)
+	}
+}
+
+func (ch refundChange) revert(es *ethState) {
+	es.refund = ch.prev
+}
+
+func (ch addLogChange) revert(es *ethState) {
+	logs := es.logs[ch.txhash]
+	if len(logs) == 1 {
+		delete(es.logs, ch.txhash)
+	} else {
+		es.logs[ch.txhash] = logs[:len(logs)-1]
+	}
+}
+
+func (ch kernelSnapshotChange) revert(es *ethState) {
+	es.kapi.(KernelAPIJournal).RevertToSnapshot(ch.id)
+}
+
+func (ch accessListAddAccountChange) revert(es *ethState) {
+	// The slots of the address were added after it, they are reverted
+	// already.
+	delete(es.accessList, *ch.address)
+}
+
+func (ch accessListAddSlotChange) revert(es *ethState) {
+	delete(es.accessList[*ch.address], ch.slot)
+}
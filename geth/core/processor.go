@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+)
+
+// Processor applies the transactions of blocks to a pair of caches. With a
+// single EU the messages are executed in sequential mode, otherwise they are
+// scheduled on numEUs EUs. Both modes produce the same receipts. The EUs are
+// created for the first block and kept for the next ones.
+//
+// The caches are never written, the writes of every processed block are
+// merged into an Overlay over them instead, which is the state the next block
+// runs on.
+type Processor struct {
+	cfg          *Config
+	state        *Overlay
+	numEUs       int
+	newKernelAPI func() KernelAPI
+
+	eu        *EU
+	scheduler *Scheduler
+}
+
+// NewProcessor creates a Processor running against eac and esc. The block
+// related fields of cfg are taken from the header of every processed block.
+func NewProcessor(cfg *Config, eac EthAccountCache, esc EthStorageCache, numEUs int, newKernelAPI func() KernelAPI) *Processor {
+	return &Processor{
+		cfg:          cfg,
+		state:        NewOverlay(eac, esc),
+		numEUs:       numEUs,
+		newKernelAPI: newKernelAPI,
+	}
+}
+
+// State returns the state after the blocks processed so far.
+func (p *Processor) State() *Overlay {
+	return p.state
+}
+
+// Process runs the transactions of block and returns the receipts, the logs,
+// the total gas used and the combined bloom of the block. The block is
+// rejected if any of its transactions is invalid, its writes are only merged
+// into the state once it has been accepted.
+func (p *Processor) Process(block *types.Block) (types.Receipts, []*types.Log, uint64, types.Bloom, error) {
+	header := block.Header()
+	cfg := *p.cfg
+	cfg.BlockNumber = header.Number
+	cfg.ParentHash = header.ParentHash
+	cfg.Time = header.Time
+	cfg.Coinbase = &header.Coinbase
+	cfg.GasLimit = header.GasLimit
+	cfg.Difficulty = header.Difficulty
+
+	signer := types.MakeSigner(cfg.ChainConfig, header.Number)
+	msgs := make([]*types.Messager, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, nil, 0, types.Bloom{}, fmt.Errorf("could not apply tx %d [%v]: %v", i, tx.Hash().Hex(), err)
+		}
+		msgs[i] = &types.Messager{
+			Txhash: tx.Hash(),
+			Msg:    &msg,
+		}
+	}
+
+	var (
+		results  []*types.EuResult
+		receipts []*types.Receipt
+		errs     []error
+	)
+	if p.numEUs > 1 {
+		if p.scheduler == nil {
+			p.scheduler = NewScheduler(&cfg, p.numEUs, p.newKernelAPI)
+		} else {
+			p.scheduler.SetConfig(&cfg)
+		}
+		results, receipts, errs = p.scheduler.Run(p.state, p.state, msgs)
+	} else {
+		results, receipts, errs = p.runSequential(&cfg, msgs)
+	}
+
+	var (
+		usedGas uint64
+		logs    []*types.Log
+	)
+	for i, receipt := range receipts {
+		if errs[i] != nil {
+			return nil, nil, 0, types.Bloom{}, fmt.Errorf("could not apply tx %d [%v]: %v", i, msgs[i].Txhash.Hex(), errs[i])
+		}
+
+		usedGas += receipt.GasUsed
+		receipt.Type = block.Transactions()[i].Type()
+		receipt.CumulativeGasUsed = usedGas
+		receipt.BlockHash = block.Hash()
+		receipt.BlockNumber = block.Number()
+		receipt.TransactionIndex = uint(i)
+		for _, log := range receipt.Logs {
+			log.BlockNumber = block.NumberU64()
+			log.TxHash = receipt.TxHash
+			log.TxIndex = uint(i)
+			log.BlockHash = block.Hash()
+			log.Index = uint(len(logs))
+			logs = append(logs, log)
+		}
+	}
+
+	writes := make([]*types.Writes, len(results))
+	for i, result := range results {
+		writes[i] = result.W
+	}
+	p.state.Merge(writes...)
+	return receipts, logs, usedGas, types.CreateBloom(receipts), nil
+}
+
+// runSequential executes msgs one after another on a single EU in sequential
+// mode, sharing a gas pool of cfg.GasLimit.
+func (p *Processor) runSequential(cfg *Config, msgs []*types.Messager) ([]*types.EuResult, []*types.Receipt, []error) {
+	if p.eu == nil {
+		kapi := p.newKernelAPI()
+		p.eu = NewEU(0, NewStateDBInSequentialMode(p.state, p.state, kapi), kapi, cfg)
+	} else {
+		// Drop the dirty cache of the previous block, its writes have been
+		// merged into the state.
+		p.eu.SetApc(p.state, p.state)
+		p.eu.SetBlockContext(cfg)
+	}
+	eu := p.eu
+	eu.SetGasPool(NewGasPool(cfg.GasLimit))
+
+	results := make([]*types.EuResult, len(msgs))
+	receipts := make([]*types.Receipt, len(msgs))
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		results[i], receipts[i], errs[i] = eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+		if errs[i] != nil {
+			break
+		}
+	}
+	return results, receipts, errs
+}
@@ -0,0 +1,313 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+	"testing"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+	"github.com/HPISTechnologies/mevm/geth/crypto"
+	"github.com/HPISTechnologies/mevm/geth/params"
+	"github.com/HPISTechnologies/mevm/geth/rlp"
+)
+
+func newTestKey(d int64) *ecdsa.PrivateKey {
+	key := &ecdsa.PrivateKey{D: big.NewInt(d)}
+	key.PublicKey.Curve = crypto.S256()
+	key.PublicKey.X, key.PublicKey.Y = key.PublicKey.Curve.ScalarBaseMult(key.D.Bytes())
+	return key
+}
+
+func TestProcessor(t *testing.T) {
+	// Emits a log and increments slot 0.
+	contract := common.BytesToAddress([]byte("contract"))
+	code := common.Hex2Bytes("60006000a060005460010160005500")
+
+	var (
+		keys    = []*ecdsa.PrivateKey{newTestKey(1), newTestKey(2)}
+		senders []common.Address
+		signer  = types.MakeSigner(params.TestChainConfig, big.NewInt(1))
+		txs     []*types.Transaction
+	)
+	for _, key := range keys {
+		for nonce := uint64(0); nonce < 2; nonce++ {
+			tx := types.NewTransaction(nonce, contract, new(big.Int), 100000, big.NewInt(1), nil)
+			h := signer.Hash(tx)
+			sig, err := crypto.Sign(h[:], key)
+			if err != nil {
+				t.Error("Checking signature failed")
+				return
+			}
+			tx, _ = tx.WithSignature(signer, sig)
+			txs = append(txs, tx)
+		}
+		sender, _ := types.Sender(signer, txs[len(txs)-1])
+		senders = append(senders, sender)
+	}
+
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Time:       big.NewInt(1),
+		Coinbase:   common.BytesToAddress([]byte("coinbase")),
+		GasLimit:   10000000,
+		Difficulty: big.NewInt(1),
+	}
+	block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+
+	newMock := func() *mockEthCache {
+		mock := &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(contract.Bytes()): &mockEthAccount{
+					balance:  new(big.Int),
+					codeHash: crypto.Keccak256(code),
+				},
+			},
+			codes: map[string][]byte{
+				string(contract.Bytes()): code,
+			},
+			storages: map[string]map[string]string{},
+		}
+		for _, sender := range senders {
+			mock.accounts[string(sender.Bytes())] = &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			}
+		}
+		return mock
+	}
+
+	var expected types.Receipts
+	for _, numEUs := range []int{1, 4} {
+		mock := newMock()
+		receipts, logs, usedGas, bloom, err := NewProcessor(newTestConfig(), mock, mock, numEUs, newMockKernelAPI).Process(block)
+		if err != nil || len(receipts) != len(txs) || len(logs) != len(txs) {
+			t.Errorf("Checking processor with %d EUs failed, got %v", numEUs, err)
+			return
+		}
+
+		var cumulative uint64
+		for i, receipt := range receipts {
+			cumulative += receipt.GasUsed
+			if receipt.Status != types.ReceiptStatusSuccessful ||
+				receipt.TxHash != txs[i].Hash() ||
+				receipt.CumulativeGasUsed != cumulative ||
+				receipt.TransactionIndex != uint(i) ||
+				receipt.BlockHash != block.Hash() ||
+				receipt.BlockNumber.Cmp(block.Number()) != 0 {
+				t.Errorf("Checking receipt %d with %d EUs failed", i, numEUs)
+				return
+			}
+			if logs[i].Index != uint(i) || logs[i].TxIndex != uint(i) || logs[i].TxHash != txs[i].Hash() || logs[i].BlockHash != block.Hash() {
+				t.Errorf("Checking log %d with %d EUs failed", i, numEUs)
+				return
+			}
+		}
+		if usedGas != cumulative || bloom != types.CreateBloom(receipts) || !types.BloomLookup(bloom, contract) {
+			t.Errorf("Checking block totals with %d EUs failed", numEUs)
+			return
+		}
+
+		if expected == nil {
+			expected = receipts
+			continue
+		}
+		for i := range receipts {
+			if receipts[i].GasUsed != expected[i].GasUsed {
+				t.Errorf("Checking receipt %d against sequential mode failed", i)
+				return
+			}
+		}
+	}
+}
+
+func TestAccessListTransactions(t *testing.T) {
+	// Increments slot 0.
+	contract := common.BytesToAddress([]byte("contract"))
+	code := common.Hex2Bytes("60005460010160005500")
+	accessList := types.AccessList{{Address: contract, StorageKeys: []common.Hash{{}}}}
+
+	signer := types.MakeSigner(params.TestChainConfig, big.NewInt(1))
+	var (
+		txs     []*types.Transaction
+		senders []common.Address
+	)
+	for i, key := range []*ecdsa.PrivateKey{newTestKey(1), newTestKey(2), newTestKey(3)} {
+		tx := types.NewAccessListTransaction(params.TestChainConfig.ChainID, 0, &contract, new(big.Int), 100000, big.NewInt(1), nil, accessList)
+		if i == 2 {
+			tx = types.NewTransaction(0, contract, new(big.Int), 100000, big.NewInt(1), nil)
+		}
+		h := signer.Hash(tx)
+		sig, _ := crypto.Sign(h[:], key)
+		tx, err := tx.WithSignature(signer, sig)
+		if err != nil {
+			t.Errorf("Checking signature %d failed, got %v", i, err)
+			return
+		}
+
+		enc, _ := rlp.EncodeToBytes(tx)
+		dec := new(types.Transaction)
+		if err := rlp.DecodeBytes(enc, dec); err != nil || dec.Hash() != tx.Hash() || dec.Type() != tx.Type() || len(dec.AccessList()) != len(tx.AccessList()) {
+			t.Errorf("Checking RLP of transaction %d failed, got %v", i, err)
+			return
+		}
+		json, _ := tx.MarshalJSON()
+		if err := dec.UnmarshalJSON(json); err != nil || dec.Hash() != tx.Hash() {
+			t.Errorf("Checking JSON of transaction %d failed, got %v", i, err)
+			return
+		}
+		sender, err := types.Sender(signer, dec)
+		if err != nil || sender != common.BytesToAddress(crypto.Keccak256(elliptic.Marshal(key.Curve, key.X, key.Y)[1:])[12:]) {
+			t.Errorf("Checking sender of transaction %d failed, got %v", i, err)
+			return
+		}
+		txs = append(txs, tx)
+		senders = append(senders, sender)
+	}
+	if _, err := types.Sender(types.NewEIP155Signer(params.TestChainConfig.ChainID), txs[0]); err != types.ErrTxTypeNotSupported {
+		t.Errorf("Checking EIP155 signer failed, got %v", err)
+		return
+	}
+
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Time:       big.NewInt(1),
+		Coinbase:   common.BytesToAddress([]byte("coinbase")),
+		GasLimit:   10000000,
+		Difficulty: big.NewInt(1),
+	}
+	block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+
+	var expected types.Receipts
+	for _, numEUs := range []int{1, 4} {
+		mock := &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(contract.Bytes()): &mockEthAccount{
+					balance:  new(big.Int),
+					codeHash: crypto.Keccak256(code),
+				},
+			},
+			codes: map[string][]byte{
+				string(contract.Bytes()): code,
+			},
+			storages: map[string]map[string]string{},
+		}
+		for _, sender := range senders {
+			mock.accounts[string(sender.Bytes())] = &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			}
+		}
+		receipts, _, _, _, err := NewProcessor(newTestConfig(), mock, mock, numEUs, newMockKernelAPI).Process(block)
+		if err != nil || len(receipts) != len(txs) {
+			t.Errorf("Checking processor with %d EUs failed, got %v", numEUs, err)
+			return
+		}
+		// The declared slot is warm, the legacy transaction pays for a cold one.
+		if receipts[1].GasUsed+params.ColdSloadCostEIP2929 != receipts[2].GasUsed+params.TxAccessListAddressGas+params.TxAccessListStorageKeyGas+params.WarmStorageReadCostEIP2929 {
+			t.Errorf("Checking gas with %d EUs failed, got %d %d", numEUs, receipts[1].GasUsed, receipts[2].GasUsed)
+			return
+		}
+
+		if expected == nil {
+			expected = receipts
+			continue
+		}
+		for i := range receipts {
+			if receipts[i].GasUsed != expected[i].GasUsed || receipts[i].Status != expected[i].Status {
+				t.Errorf("Checking receipt %d against sequential mode failed", i)
+				return
+			}
+		}
+	}
+}
+
+func TestProcessorConsecutiveBlocks(t *testing.T) {
+	// Emits a log and increments slot 0.
+	contract := common.BytesToAddress([]byte("contract"))
+	code := common.Hex2Bytes("60006000a060005460010160005500")
+
+	var (
+		funder = newTestKey(1)
+		funded = newTestKey(2)
+		signer = types.MakeSigner(params.TestChainConfig, big.NewInt(1))
+	)
+	toAddress := func(key *ecdsa.PrivateKey) common.Address {
+		return common.BytesToAddress(crypto.Keccak256(elliptic.Marshal(key.Curve, key.X, key.Y)[1:])[12:])
+	}
+	fundedAddr := toAddress(funded)
+	sign := func(tx *types.Transaction, key *ecdsa.PrivateKey) *types.Transaction {
+		h := signer.Hash(tx)
+		sig, _ := crypto.Sign(h[:], key)
+		tx, _ = tx.WithSignature(signer, sig)
+		return tx
+	}
+	newBlock := func(number int64, txs []*types.Transaction) *types.Block {
+		header := &types.Header{
+			Number:     big.NewInt(number),
+			Time:       big.NewInt(number),
+			Coinbase:   common.BytesToAddress([]byte("coinbase")),
+			GasLimit:   10000000,
+			Difficulty: big.NewInt(1),
+		}
+		return types.NewBlockWithHeader(header).WithBody(txs, nil)
+	}
+
+	// The second block only applies on top of the first one, the funded
+	// account pays for its gas with the value it received and the funder
+	// continues with its nonce.
+	blocks := []*types.Block{
+		newBlock(1, []*types.Transaction{
+			sign(types.NewTransaction(0, fundedAddr, big.NewInt(200000), 100000, big.NewInt(1), nil), funder),
+			sign(types.NewTransaction(1, contract, new(big.Int), 100000, big.NewInt(1), nil), funder),
+		}),
+		newBlock(2, []*types.Transaction{
+			sign(types.NewTransaction(0, contract, new(big.Int), 100000, big.NewInt(1), nil), funded),
+			sign(types.NewTransaction(2, contract, new(big.Int), 100000, big.NewInt(1), nil), funder),
+		}),
+	}
+
+	for _, numEUs := range []int{1, 4} {
+		mock := &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(contract.Bytes()): &mockEthAccount{
+					balance:  new(big.Int),
+					codeHash: crypto.Keccak256(code),
+				},
+				string(toAddress(funder).Bytes()): &mockEthAccount{
+					balance: new(big.Int).SetInt64(1000000),
+				},
+			},
+			codes: map[string][]byte{
+				string(contract.Bytes()): code,
+			},
+			storages: map[string]map[string]string{},
+		}
+		processor := NewProcessor(newTestConfig(), mock, mock, numEUs, newMockKernelAPI)
+		for _, block := range blocks {
+			receipts, _, _, _, err := processor.Process(block)
+			if err != nil {
+				t.Errorf("Checking block %d with %d EUs failed, got %v", block.NumberU64(), numEUs, err)
+				return
+			}
+			for i, receipt := range receipts {
+				if receipt.Status != types.ReceiptStatusSuccessful {
+					t.Errorf("Checking receipt %d of block %d with %d EUs failed", i, block.NumberU64(), numEUs)
+					return
+				}
+			}
+		}
+
+		state := processor.State()
+		value := state.GetState(string(contract.Bytes()), common.Hash{}.Bytes())
+		acc, _ := state.GetAccount(string(fundedAddr.Bytes()))
+		if common.BytesToHash(value) != common.BigToHash(big.NewInt(3)) ||
+			acc == nil || acc.GetNonce() != 1 {
+			t.Errorf("Checking state with %d EUs failed", numEUs)
+			return
+		}
+		if _, ok := mock.storages[string(contract.Bytes())]; ok {
+			t.Errorf("Checking base caches with %d EUs failed", numEUs)
+			return
+		}
+	}
+}
@@ -0,0 +1,600 @@
+package core
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+	"github.com/HPISTechnologies/mevm/geth/core/vm"
+	"github.com/HPISTechnologies/mevm/geth/crypto"
+)
+
+// mvStore is a multi-version view of the writes in a block. It keeps the
+// latest write set of every transaction, a transaction at index i sees the
+// base caches updated with the writes of the transactions before it, applied
+// in the same way as dirtyCache.localCommit does in sequential mode.
+//
+// The write sets are indexed by address and by storage slot, each key maps
+// to the sorted indices of the transactions writing it. A lookup only visits
+// the transactions touching the key instead of all the ones before i.
+type mvStore struct {
+	accountCache EthAccountCache
+	storageCache EthStorageCache
+	writes       []*types.Writes
+	accounts     map[common.Address][]int
+	suicides     map[common.Address][]int
+	slots        map[common.Address]map[common.Hash][]int
+}
+
+func newMvStore(eac EthAccountCache, esc EthStorageCache, size int) *mvStore {
+	return &mvStore{
+		accountCache: eac,
+		storageCache: esc,
+		writes:       make([]*types.Writes, size),
+		accounts:     make(map[common.Address][]int),
+		suicides:     make(map[common.Address][]int),
+		slots:        make(map[common.Address]map[common.Hash][]int),
+	}
+}
+
+// set replaces the write set of the transaction at index i, w may be nil. It
+// must not be called while the store is being read.
+func (s *mvStore) set(i int, w *types.Writes) {
+	if old := s.writes[i]; old != nil {
+		for addr := range writtenAddresses(old) {
+			s.accounts[addr] = removeIndex(s.accounts[addr], i)
+		}
+		for _, addr := range old.Suicided {
+			s.suicides[addr] = removeIndex(s.suicides[addr], i)
+		}
+		for addr, storage := range old.EthStorageWrites {
+			for key := range storage {
+				s.slots[addr][key] = removeIndex(s.slots[addr][key], i)
+			}
+		}
+	}
+
+	s.writes[i] = w
+	if w == nil {
+		return
+	}
+	for addr := range writtenAddresses(w) {
+		s.accounts[addr] = insertIndex(s.accounts[addr], i)
+	}
+	for _, addr := range w.Suicided {
+		s.suicides[addr] = insertIndex(s.suicides[addr], i)
+	}
+	for addr, storage := range w.EthStorageWrites {
+		if _, ok := s.slots[addr]; !ok {
+			s.slots[addr] = make(map[common.Hash][]int)
+		}
+		for key := range storage {
+			s.slots[addr][key] = insertIndex(s.slots[addr][key], i)
+		}
+	}
+}
+
+// account returns the account addr as seen by the transaction at index i, or
+// nil if it doesn't exist.
+func (s *mvStore) account(i int, addr common.Address) *dirtyAccount {
+	if da := s.load(i, addr); da != nil && !da.deleted {
+		return da
+	}
+	return nil
+}
+
+// load returns the account addr as seen by the transaction at index i, an
+// account deleted by a suicide is returned with its deleted flag set.
+func (s *mvStore) load(i int, addr common.Address) *dirtyAccount {
+	var da *dirtyAccount
+	if acc, _ := s.accountCache.GetAccount(string(addr.Bytes())); acc != nil {
+		da = newDirtyAccountFrom(acc)
+	}
+
+	indices := s.accounts[addr]
+	for _, j := range indices[:sort.SearchInts(indices, i)] {
+		w := s.writes[j]
+		if da != nil && da.deleted {
+			// Written again after a suicide, the account is recreated
+			// empty.
+			da.deleted = false
+		}
+		if containsAddress(w.NewAccounts, addr) {
+			cleared := da != nil && da.cleared
+			da = newDirtyAccount()
+			da.cleared = cleared
+		}
+		if amount, ok := w.BalanceWrites[addr]; ok {
+			if da == nil {
+				da = newDirtyAccount()
+			}
+			da.balance = new(big.Int).Add(da.balance, amount)
+		}
+		if nonce, ok := w.NonceWrites[addr]; ok {
+			if da == nil {
+				da = newDirtyAccount()
+			}
+			da.nonce = nonce
+		}
+		if code, ok := w.CodeWrites[addr]; ok {
+			if da == nil {
+				da = newDirtyAccount()
+			}
+			da.code = code
+			da.codeHash = crypto.Keccak256Hash(code).Bytes()
+		}
+		if _, ok := w.EthStorageWrites[addr]; ok && da == nil {
+			da = newDirtyAccount()
+		}
+		if containsAddress(w.Suicided, addr) {
+			da = newDeletedAccount()
+		}
+	}
+	return da
+}
+
+// code returns the code of addr as seen by the transaction at index i.
+func (s *mvStore) code(i int, addr common.Address) ([]byte, error) {
+	if da := s.load(i, addr); da != nil && (da.code != nil || da.cleared) {
+		return da.code, nil
+	}
+	return s.accountCache.GetCode(string(addr.Bytes()))
+}
+
+// state returns the value of the storage slot key of addr as seen by the
+// transaction at index i.
+func (s *mvStore) state(i int, addr common.Address, key common.Hash) common.Hash {
+	// A suicide clears the storage after the writes of its transaction.
+	suicide, write := lastIndexBefore(s.suicides[addr], i), lastIndexBefore(s.slots[addr][key], i)
+	if suicide >= 0 && suicide >= write {
+		return common.Hash{}
+	}
+	if write >= 0 {
+		return s.writes[write].EthStorageWrites[addr][key]
+	}
+	return common.BytesToHash(s.storageCache.GetState(string(addr.Bytes()), key.Bytes()))
+}
+
+// writtenAddresses returns the addresses w touches at the account level.
+func writtenAddresses(w *types.Writes) map[common.Address]struct{} {
+	addrs := make(map[common.Address]struct{})
+	for _, addr := range w.NewAccounts {
+		addrs[addr] = struct{}{}
+	}
+	for addr := range w.BalanceWrites {
+		addrs[addr] = struct{}{}
+	}
+	for addr := range w.NonceWrites {
+		addrs[addr] = struct{}{}
+	}
+	for addr := range w.CodeWrites {
+		addrs[addr] = struct{}{}
+	}
+	for addr := range w.EthStorageWrites {
+		addrs[addr] = struct{}{}
+	}
+	for _, addr := range w.Suicided {
+		addrs[addr] = struct{}{}
+	}
+	return addrs
+}
+
+// insertIndex adds i to the sorted indices if it isn't there yet.
+func insertIndex(indices []int, i int) []int {
+	k := sort.SearchInts(indices, i)
+	if k < len(indices) && indices[k] == i {
+		return indices
+	}
+	indices = append(indices, 0)
+	copy(indices[k+1:], indices[k:])
+	indices[k] = i
+	return indices
+}
+
+// removeIndex removes i from the sorted indices.
+func removeIndex(indices []int, i int) []int {
+	k := sort.SearchInts(indices, i)
+	if k == len(indices) || indices[k] != i {
+		return indices
+	}
+	return append(indices[:k], indices[k+1:]...)
+}
+
+// lastIndexBefore returns the greatest of the sorted indices lower than i, or
+// -1 if there is none.
+func lastIndexBefore(indices []int, i int) int {
+	if k := sort.SearchInts(indices, i); k > 0 {
+		return indices[k-1]
+	}
+	return -1
+}
+
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// mvAccount is an account served by an mvView, it records which fields the
+// EU has read.
+type mvAccount struct {
+	account      *dirtyAccount
+	balanceRead  bool
+	nonceRead    bool
+	codeHashRead bool
+}
+
+func (acc *mvAccount) GetBalance() *big.Int {
+	acc.balanceRead = true
+	return acc.account.GetBalance()
+}
+
+func (acc *mvAccount) GetNonce() uint64 {
+	acc.nonceRead = true
+	return acc.account.GetNonce()
+}
+
+func (acc *mvAccount) GetCodeHash() []byte {
+	acc.codeHashRead = true
+	return acc.account.GetCodeHash()
+}
+
+// mvView is the EthAccountCache and EthStorageCache of the EU executing the
+// transaction at index. It logs every value it serves, which is the read set
+// of the EU at the cache level. Unlike the read set of ethState, it also
+// covers the balance checks made through GetBalanceNoRecord.
+type mvView struct {
+	store    *mvStore
+	index    int
+	sealed   bool
+	deferred bool // The EU has called the kernel API while it was disabled
+	accounts map[common.Address]*mvAccount
+	codes    map[common.Address][]byte
+	storages map[common.Address]map[common.Hash]common.Hash
+}
+
+func newMvView(store *mvStore, index int) *mvView {
+	return &mvView{
+		store:    store,
+		index:    index,
+		accounts: make(map[common.Address]*mvAccount),
+		codes:    make(map[common.Address][]byte),
+		storages: make(map[common.Address]map[common.Hash]common.Hash),
+	}
+}
+
+// seal stops the logging. Reads made after the transaction has been executed,
+// like the balance origins of the EuResult, don't affect its validity.
+func (v *mvView) seal() {
+	v.sealed = true
+}
+
+func (v *mvView) GetAccount(addr string) (Account, error) {
+	address := common.BytesToAddress([]byte(addr))
+	acc, ok := v.accounts[address]
+	if !ok {
+		acc = &mvAccount{account: v.store.account(v.index, address)}
+		if !v.sealed {
+			v.accounts[address] = acc
+		}
+	}
+
+	if acc.account == nil {
+		return nil, nil
+	}
+	if v.sealed {
+		return acc.account, nil
+	}
+	return acc, nil
+}
+
+func (v *mvView) GetCode(addr string) ([]byte, error) {
+	address := common.BytesToAddress([]byte(addr))
+	if code, ok := v.codes[address]; ok {
+		return code, nil
+	}
+
+	code, err := v.store.code(v.index, address)
+	if err != nil {
+		return nil, err
+	}
+	if !v.sealed {
+		v.codes[address] = code
+	}
+	return code, nil
+}
+
+func (v *mvView) GetState(addr string, key []byte) []byte {
+	address := common.BytesToAddress([]byte(addr))
+	hash := common.BytesToHash(key)
+	if storage, ok := v.storages[address]; ok {
+		if value, ok := storage[hash]; ok {
+			return value.Bytes()
+		}
+	}
+
+	value := v.store.state(v.index, address, hash)
+	if !v.sealed {
+		if _, ok := v.storages[address]; !ok {
+			v.storages[address] = make(map[common.Hash]common.Hash)
+		}
+		v.storages[address][hash] = value
+	}
+	return value.Bytes()
+}
+
+// validate reports whether every value served to the EU is still the one the
+// transaction would see in the store. An execution deferred because it needed
+// the kernel API is never valid.
+func (v *mvView) validate() bool {
+	if v.deferred {
+		return false
+	}
+
+	for addr, acc := range v.accounts {
+		current := v.store.account(v.index, addr)
+		if (acc.account == nil) != (current == nil) {
+			return false
+		}
+		if current == nil {
+			continue
+		}
+		if acc.balanceRead && acc.account.balance.Cmp(current.balance) != 0 ||
+			acc.nonceRead && acc.account.nonce != current.nonce ||
+			acc.codeHashRead && !bytes.Equal(acc.account.codeHash, current.codeHash) {
+			return false
+		}
+	}
+
+	for addr, code := range v.codes {
+		if current, _ := v.store.code(v.index, addr); !bytes.Equal(code, current) {
+			return false
+		}
+	}
+
+	for addr, storage := range v.storages {
+		for key, value := range storage {
+			if v.store.state(v.index, addr, key) != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Scheduler executes the transactions of a block optimistically on a pool of
+// EUs, in the style of Block-STM. All transactions are executed in parallel
+// against a multi-version store of the writes, then every transaction is
+// validated against the updated store and only the invalidated ones are
+// executed again. This is repeated until no transaction is invalidated. The
+// first invalidated transaction always sees the final writes of the ones
+// before it, so the number of rounds never exceeds the number of transactions.
+//
+// A transaction declaring a storage key in its access list (EIP-2930) that is
+// declared by a transaction before it is predicted to conflict with it, it is
+// held back from the first round. The access lists don't tell the reads from
+// the writes, so the prediction doesn't go beyond the first round.
+//
+// The kernel API state is shared by the EUs and isn't versioned, so it is only
+// called by the first pending transaction of a round. That transaction has seen
+// the final versions of the ones before it, its execution is never discarded
+// and the kernel API sees the calls in the order of the block. The kernel API
+// calls of the other transactions fail, such a transaction is deferred until it
+// is the first pending one.
+type Scheduler struct {
+	executor *ParallelExecutor
+}
+
+// NewScheduler creates a Scheduler running on numEUs EUs.
+func NewScheduler(cfg *Config, numEUs int, newKernelAPI func() KernelAPI) *Scheduler {
+	return &Scheduler{
+		executor: NewParallelExecutor(cfg, numEUs, func() KernelAPI {
+			return &schedulerKernelAPI{KernelAPI: newKernelAPI()}
+		}),
+	}
+}
+
+// SetConfig moves the EUs of the Scheduler to the block described by cfg.
+func (s *Scheduler) SetConfig(cfg *Config) {
+	s.executor.SetConfig(cfg)
+}
+
+// Run executes msgs against eac and esc. The results, receipts and errors are
+// the same as if msgs were executed one after another, each of them seeing the
+// writes of the ones before it. An invalid message has a nil result and
+// receipt, and its error is set.
+//
+// As with a GasPool of cfg.GasLimit in sequential execution, a message is
+// rejected with ErrGasLimitReached if its gas doesn't fit in what the messages
+// before it have left, the messages after it may still fit.
+func (s *Scheduler) Run(eac EthAccountCache, esc EthStorageCache, msgs []*types.Messager) ([]*types.EuResult, []*types.Receipt, []error) {
+	store := newMvStore(eac, esc, len(msgs))
+	results := make([]*types.EuResult, len(msgs))
+	receipts := make([]*types.Receipt, len(msgs))
+	errs := make([]error, len(msgs))
+	views := make([]*mvView, len(msgs))
+
+	conflicts := declaredConflicts(msgs)
+	pending := make([]int, 0, len(msgs))
+	for i := range msgs {
+		if !conflicts[i] {
+			pending = append(pending, i)
+		}
+	}
+	coinbase := *s.executor.cfg.Coinbase
+	remaining, next := s.executor.cfg.GasLimit, 0
+	for {
+		// The transactions before the first pending one have seen the final
+		// versions of the ones before them, they are accepted in order. A
+		// message that doesn't fit in the gas left is rejected, its writes are
+		// dropped and the transactions after it are validated again.
+		first := len(msgs)
+		if len(pending) > 0 {
+			first = pending[0]
+		}
+		dropped := false
+		for ; next < first && !dropped; next++ {
+			if errs[next] != nil {
+				continue
+			}
+			if msgs[next].Msg.Gas() > remaining {
+				results[next], receipts[next] = nil, nil
+				errs[next] = &InvalidTransactionError{Hash: msgs[next].Txhash, Err: ErrGasLimitReached}
+				store.set(next, nil)
+				dropped = true
+				continue
+			}
+			remaining -= results[next].GasUsed
+		}
+		if !dropped && len(pending) == 0 {
+			break
+		}
+
+		from := next
+		if !dropped {
+			// A transaction deferred because it needs the kernel API waits
+			// until it is the first pending one.
+			run := make([]int, 0, len(pending))
+			for _, i := range pending {
+				if i == first || views[i] == nil || !views[i].deferred {
+					run = append(run, i)
+				}
+			}
+
+			// The store is only updated between rounds, so all the EUs in a
+			// round see the same versions.
+			s.executor.execute(len(run), func(eu *EU, k int) {
+				i := run[k]
+				kapi := eu.kapi.(*schedulerKernelAPI)
+				// The first pending transaction is final, unless it doesn't fit
+				// in the block.
+				kapi.enabled = i == first && msgs[i].Msg.Gas() <= remaining
+				views[i] = newMvView(store, i)
+				eu.SetApc(views[i], views[i])
+				execResult, err := eu.apply(msgs[i].Txhash, msgs[i].Msg, coinbase)
+				views[i].seal()
+				views[i].deferred = kapi.deferred
+				if err != nil {
+					results[i], receipts[i], errs[i] = nil, nil, err
+					return
+				}
+				results[i], receipts[i] = eu.collect(msgs[i].Txhash, msgs[i].Msg, execResult)
+				errs[i] = nil
+			})
+			for _, i := range run {
+				if results[i] != nil {
+					store.set(i, results[i].W)
+				} else {
+					store.set(i, nil)
+				}
+			}
+			// The first pending transaction can't be invalidated.
+			from = first + 1
+		}
+
+		invalid := make([]bool, len(msgs))
+		s.executor.execute(len(msgs)-from, func(eu *EU, k int) {
+			i := from + k
+			// The transactions held back have no view yet.
+			invalid[i] = views[i] == nil || !views[i].validate()
+		})
+
+		pending = pending[:0]
+		for i := from; i < len(msgs); i++ {
+			if invalid[i] {
+				pending = append(pending, i)
+			}
+		}
+	}
+
+	// The balance origins were read after the views had been sealed, refresh
+	// them with the final versions.
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		for addr := range result.W.BalanceOrigin {
+			if acc := store.account(i, addr); acc != nil {
+				result.W.BalanceOrigin[addr] = acc.balance
+			} else {
+				result.W.BalanceOrigin[addr] = new(big.Int)
+			}
+		}
+	}
+	return results, receipts, errs
+}
+
+// declaredConflicts reports for every message whether it declares a storage
+// key in its access list that is declared by a message before it.
+func declaredConflicts(msgs []*types.Messager) []bool {
+	conflicts := make([]bool, len(msgs))
+	declared := make(map[common.Address]map[common.Hash]struct{})
+	for i, msg := range msgs {
+		list := msg.Msg.AccessList()
+		for _, tuple := range list {
+			for _, key := range tuple.StorageKeys {
+				if _, ok := declared[tuple.Address][key]; ok {
+					conflicts[i] = true
+				}
+			}
+		}
+		for _, tuple := range list {
+			if _, ok := declared[tuple.Address]; !ok {
+				declared[tuple.Address] = make(map[common.Hash]struct{})
+			}
+			for _, key := range tuple.StorageKeys {
+				declared[tuple.Address][key] = struct{}{}
+			}
+		}
+	}
+	return conflicts
+}
+
+// schedulerKernelAPI is the KernelAPI of an EU of a Scheduler. While it is
+// disabled, the calls fail without reaching the KernelAPI and the execution is
+// marked as deferred.
+type schedulerKernelAPI struct {
+	KernelAPI
+	enabled  bool
+	deferred bool
+}
+
+func (kapi *schedulerKernelAPI) Prepare(thash common.Hash) {
+	kapi.deferred = false
+	kapi.KernelAPI.Prepare(thash)
+}
+
+func (kapi *schedulerKernelAPI) Call(call *vm.KernelCall) ([]byte, uint64, bool) {
+	if !kapi.enabled {
+		kapi.deferred = true
+		// Report more than any budget, the execution is discarded anyway.
+		return nil, math.MaxUint64, false
+	}
+	return kapi.KernelAPI.Call(call)
+}
+
+func (kapi *schedulerKernelAPI) Snapshot() int {
+	if journal, ok := kapi.KernelAPI.(KernelAPIJournal); ok {
+		return journal.Snapshot()
+	}
+	return 0
+}
+
+func (kapi *schedulerKernelAPI) RevertToSnapshot(id int) {
+	if journal, ok := kapi.KernelAPI.(KernelAPIJournal); ok {
+		journal.RevertToSnapshot(id)
+	}
+}
+
+func (kapi *schedulerKernelAPI) Collect() (reads, writes []string) {
+	if collector, ok := kapi.KernelAPI.(KernelAPICollector); ok {
+		return collector.Collect()
+	}
+	return nil, nil
+}
@@ -0,0 +1,444 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
+	"github.com/HPISTechnologies/mevm/geth/core/vm"
+	"github.com/HPISTechnologies/mevm/geth/crypto"
+)
+
+func TestScheduler(t *testing.T) {
+	senders := []common.Address{
+		common.BytesToAddress([]byte{1}),
+		common.BytesToAddress([]byte{2}),
+		common.BytesToAddress([]byte{3}),
+		common.BytesToAddress([]byte{4}),
+	}
+	receiver := common.BytesToAddress([]byte("receiver"))
+	counter := common.BytesToAddress([]byte("counter"))
+	funded := common.BytesToAddress([]byte("funded"))
+
+	newMock := func() *mockEthCache {
+		mock := &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(receiver.Bytes()): &mockEthAccount{
+					balance: new(big.Int),
+				},
+				string(counter.Bytes()): &mockEthAccount{
+					balance: new(big.Int),
+				},
+				string(newTestConfig().Coinbase.Bytes()): &mockEthAccount{
+					balance: new(big.Int),
+				},
+			},
+			codes: map[string][]byte{
+				// sstore(0, add(sload(0), 1))
+				string(counter.Bytes()): common.Hex2Bytes("60005460010160005500"),
+			},
+		}
+		for _, sender := range senders {
+			mock.accounts[string(sender.Bytes())] = &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			}
+		}
+		return mock
+	}
+
+	// Every sender increases the counter and pays the receiver, the second
+	// sender does it twice. The funded account can only pay for the gas once
+	// it has been funded.
+	msgs := []*types.Messager{
+		newTestMessager(funded, &receiver, 0, 1, nil),
+		newTestMessager(senders[0], &counter, 0, 0, nil),
+		newTestMessager(senders[1], &receiver, 0, 1, nil),
+		newTestMessager(senders[1], &counter, 1, 0, nil),
+		newTestMessager(senders[2], &counter, 0, 0, nil),
+		newTestMessager(senders[3], &receiver, 0, 1, nil),
+		newTestMessager(senders[3], &counter, 1, 0, nil),
+		newTestMessager(senders[0], &funded, 1, 200000, nil),
+		newTestMessager(funded, &receiver, 1, 1, nil),
+	}
+
+	scheduler := NewScheduler(newTestConfig(), 4, newMockKernelAPI)
+	results, receipts, errs := scheduler.Run(newMock(), newMock(), msgs)
+
+	kapi := newMockKernelAPI()
+	mock := newMock()
+	eu := NewEU(0, NewStateDBInSequentialMode(mock, mock, kapi), kapi, newTestConfig())
+	for i, msg := range msgs {
+		result, receipt, err := eu.Run(msg.Txhash, msg.Msg, *newTestConfig().Coinbase)
+		if (err == nil) != (errs[i] == nil) {
+			t.Errorf("Checking error %d failed", i)
+			return
+		}
+		if err != nil {
+			continue
+		}
+		if results[i].H != result.H ||
+			receipts[i].Status != receipt.Status ||
+			receipts[i].GasUsed != receipt.GasUsed {
+			t.Errorf("Checking receipt %d failed", i)
+			return
+		}
+		if len(results[i].W.EthStorageWrites) != len(result.W.EthStorageWrites) ||
+			results[i].W.EthStorageWrites[counter][common.Hash{}] != result.W.EthStorageWrites[counter][common.Hash{}] {
+			t.Errorf("Checking storage writes of result %d failed", i)
+			return
+		}
+		if len(results[i].W.NonceWrites) != len(result.W.NonceWrites) ||
+			results[i].W.NonceWrites[msg.Msg.From()] != result.W.NonceWrites[msg.Msg.From()] {
+			t.Errorf("Checking nonce writes of result %d failed", i)
+			return
+		}
+		for addr, origin := range result.W.BalanceOrigin {
+			if results[i].W.BalanceOrigin[addr].Cmp(origin) != 0 {
+				t.Errorf("Checking balance origin of result %d failed", i)
+				return
+			}
+		}
+	}
+
+	if errs[0] == nil || errs[8] != nil {
+		t.Error("Checking funded account failed")
+		return
+	}
+	if results[6].W.EthStorageWrites[counter][common.Hash{}] != common.BigToHash(new(big.Int).SetInt64(4)) {
+		t.Error("Checking counter failed")
+		return
+	}
+}
+
+func TestSchedulerGasLimit(t *testing.T) {
+	senders := []common.Address{
+		common.BytesToAddress([]byte{1}),
+		common.BytesToAddress([]byte{2}),
+		common.BytesToAddress([]byte{3}),
+		common.BytesToAddress([]byte{4}),
+	}
+	counter := common.BytesToAddress([]byte("counter"))
+
+	newMock := func() *mockEthCache {
+		mock := &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(counter.Bytes()): &mockEthAccount{
+					balance: new(big.Int),
+				},
+				string(newTestConfig().Coinbase.Bytes()): &mockEthAccount{
+					balance: new(big.Int),
+				},
+			},
+			codes: map[string][]byte{
+				// sstore(0, add(sload(0), 1))
+				string(counter.Bytes()): common.Hex2Bytes("60005460010160005500"),
+			},
+		}
+		for _, sender := range senders {
+			mock.accounts[string(sender.Bytes())] = &mockEthAccount{
+				balance: new(big.Int).SetInt64(1000000),
+			}
+		}
+		return mock
+	}
+
+	// Every message increases the counter, the ones asking for 300000 gas
+	// don't fit in the block, the ones after them still do.
+	var msgs []*types.Messager
+	for i, gas := range []uint64{100000, 300000, 100000, 300000} {
+		msg := types.NewMessage(senders[i], &counter, 0, new(big.Int), gas, new(big.Int).SetInt64(1), nil, nil, false)
+		msgs = append(msgs, &types.Messager{Txhash: common.BytesToHash([]byte{byte(i)}), Msg: &msg})
+	}
+	cfg := newTestConfig()
+	cfg.GasLimit = 250000
+
+	scheduler := NewScheduler(cfg, 4, newMockKernelAPI)
+	results, _, errs := scheduler.Run(newMock(), newMock(), msgs)
+
+	kapi := newMockKernelAPI()
+	mock := newMock()
+	eu := NewEU(0, NewStateDBInSequentialMode(mock, mock, kapi), kapi, cfg)
+	eu.SetGasPool(NewGasPool(cfg.GasLimit))
+	for i, msg := range msgs {
+		result, _, err := eu.Run(msg.Txhash, msg.Msg, *cfg.Coinbase)
+		if (err == nil) != (errs[i] == nil) || err != nil && !errors.Is(errs[i], ErrGasLimitReached) {
+			t.Errorf("Checking error %d failed, got %v", i, errs[i])
+			return
+		}
+		if err == nil && results[i].W.EthStorageWrites[counter][common.Hash{}] != result.W.EthStorageWrites[counter][common.Hash{}] {
+			t.Errorf("Checking counter of result %d failed", i)
+			return
+		}
+	}
+	if errs[1] == nil || errs[2] != nil || results[2].W.EthStorageWrites[counter][common.Hash{}] != common.BigToHash(big.NewInt(2)) {
+		t.Error("Checking message after the full block failed")
+		return
+	}
+}
+
+func TestDeclaredConflicts(t *testing.T) {
+	sender := common.BytesToAddress([]byte{1})
+	counter := common.BytesToAddress([]byte("counter"))
+	key1 := common.BytesToHash([]byte("key1"))
+	key2 := common.BytesToHash([]byte("key2"))
+
+	var msgs []*types.Messager
+	for i, accessList := range []types.AccessList{
+		{{Address: counter, StorageKeys: []common.Hash{key1, key1}}},
+		{{Address: counter, StorageKeys: []common.Hash{key2}}},
+		{{Address: sender, StorageKeys: []common.Hash{key1}}},
+		nil,
+		{{Address: counter}, {Address: counter, StorageKeys: []common.Hash{key2}}},
+	} {
+		msg := types.NewMessage(sender, &counter, uint64(i), new(big.Int), 100000, new(big.Int).SetInt64(1), nil, accessList, false)
+		msgs = append(msgs, &types.Messager{Msg: &msg})
+	}
+	conflicts := declaredConflicts(msgs)
+	if conflicts[0] || conflicts[1] || conflicts[2] || conflicts[3] || !conflicts[4] {
+		t.Errorf("Checking declared conflicts failed, got %v", conflicts)
+		return
+	}
+}
+
+func TestMvStore(t *testing.T) {
+	addr := common.BytesToAddress([]byte("addr"))
+	key := common.BytesToHash([]byte("key"))
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			string(addr.Bytes()): &mockEthAccount{
+				balance: big.NewInt(100),
+			},
+		},
+	}
+	newWrites := func(amount int64, value string) *types.Writes {
+		return &types.Writes{
+			BalanceWrites: map[common.Address]*big.Int{addr: big.NewInt(amount)},
+			EthStorageWrites: map[common.Address]map[common.Hash]common.Hash{
+				addr: {key: common.BytesToHash([]byte(value))},
+			},
+		}
+	}
+
+	store := newMvStore(mock, mock, 4)
+	store.set(0, newWrites(1, "v0"))
+	store.set(2, newWrites(2, "v2"))
+	if store.account(2, addr).balance.Int64() != 101 ||
+		store.account(3, addr).balance.Int64() != 103 ||
+		store.state(2, addr, key) != common.BytesToHash([]byte("v0")) ||
+		store.state(3, addr, key) != common.BytesToHash([]byte("v2")) {
+		t.Error("Checking versions failed")
+		return
+	}
+
+	// Replacing a write set drops the keys it no longer writes.
+	store.set(2, &types.Writes{Suicided: []common.Address{addr}})
+	store.set(0, nil)
+	if len(store.accounts[addr]) != 1 ||
+		store.state(2, addr, key) != (common.Hash{}) ||
+		store.state(3, addr, key) != (common.Hash{}) ||
+		store.account(1, addr).balance.Int64() != 100 {
+		t.Error("Checking replaced write sets failed")
+		return
+	}
+}
+
+func TestSchedulerSuicideAndRedeploy(t *testing.T) {
+	sender := common.BytesToAddress([]byte("sender"))
+	factory := common.BytesToAddress([]byte("factory"))
+	// The child returns selfdestruct(caller) as its code.
+	initCode := common.Hex2Bytes("6133ff6000526002601ef3")
+	child := crypto.CreateAddress2(factory, [32]byte{}, crypto.Keccak256(initCode))
+
+	newMock := func() *mockEthCache {
+		return &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(sender.Bytes()): &mockEthAccount{
+					balance: new(big.Int).SetInt64(1000000),
+				},
+				string(factory.Bytes()): &mockEthAccount{
+					balance: new(big.Int),
+				},
+				string(newTestConfig().Coinbase.Bytes()): &mockEthAccount{
+					balance: new(big.Int),
+				},
+			},
+			codes: map[string][]byte{
+				// sstore(0, create2(0, 0, calldatasize, 0)) of the calldata
+				string(factory.Bytes()): common.Hex2Bytes("36600060003760003660006000f560005500"),
+			},
+		}
+	}
+
+	// The child is deployed, destroyed and deployed again at the same
+	// address.
+	msgs := []*types.Messager{
+		newTestMessager(sender, &factory, 0, 0, initCode),
+		newTestMessager(sender, &child, 1, 5, nil),
+		newTestMessager(sender, &factory, 2, 0, initCode),
+	}
+
+	scheduler := NewScheduler(newTestConfig(), 4, newMockKernelAPI)
+	results, receipts, errs := scheduler.Run(newMock(), newMock(), msgs)
+
+	kapi := newMockKernelAPI()
+	mock := newMock()
+	eu := NewEU(0, NewStateDBInSequentialMode(mock, mock, kapi), kapi, newTestConfig())
+	for i, msg := range msgs {
+		result, receipt, err := eu.Run(msg.Txhash, msg.Msg, *newTestConfig().Coinbase)
+		if err != nil || errs[i] != nil {
+			t.Errorf("Checking error %d failed", i)
+			return
+		}
+		if results[i].H != result.H ||
+			receipts[i].Status != receipt.Status ||
+			receipts[i].GasUsed != receipt.GasUsed {
+			t.Errorf("Checking result %d failed", i)
+			return
+		}
+	}
+
+	if !containsAddress(results[1].W.Suicided, child) {
+		t.Error("Checking suicide failed")
+		return
+	}
+	if _, ok := results[2].W.CodeWrites[child]; !ok ||
+		results[2].W.EthStorageWrites[factory][common.Hash{}] != common.BytesToHash(child.Bytes()) {
+		t.Error("Checking redeployment failed")
+		return
+	}
+}
+
+// kernelStore is the kernel API state shared by the EUs of a Scheduler.
+type kernelStore struct {
+	mu    sync.Mutex
+	value []byte
+	calls []common.Hash // Transactions in the order of their calls
+	// If gate is set, the calls of the other transactions wait until opener
+	// has called the kernel API or has been executed.
+	gate   chan struct{}
+	opener common.Hash
+}
+
+func (store *kernelStore) open(thash common.Hash) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.gate != nil && thash == store.opener {
+		close(store.gate)
+		store.gate = nil
+	}
+}
+
+func (store *kernelStore) wait(thash common.Hash) {
+	store.mu.Lock()
+	gate := store.gate
+	store.mu.Unlock()
+	if gate != nil && thash != store.opener {
+		<-gate
+	}
+}
+
+// sharedKernelAPI stores a single value. A call with an input writes it, a
+// call without one reads it and fails if it hasn't been written.
+type sharedKernelAPI struct {
+	mockKernelAPI
+	addr          common.Address
+	store         *kernelStore
+	thash         common.Hash
+	reads, writes []string
+}
+
+func (mock *sharedKernelAPI) IsKernelAPI(addr common.Address) bool {
+	return addr == mock.addr
+}
+
+func (mock *sharedKernelAPI) Prepare(thash common.Hash) {
+	mock.thash, mock.reads, mock.writes = thash, nil, nil
+}
+
+func (mock *sharedKernelAPI) Call(call *vm.KernelCall) ([]byte, uint64, bool) {
+	mock.store.wait(mock.thash)
+	defer mock.store.open(mock.thash)
+	mock.store.mu.Lock()
+	defer mock.store.mu.Unlock()
+	mock.store.calls = append(mock.store.calls, mock.thash)
+
+	if len(call.Input) == 0 {
+		mock.reads = append(mock.reads, "value")
+		return mock.store.value, 0, mock.store.value != nil
+	}
+	mock.store.value = call.Input
+	mock.writes = append(mock.writes, "value")
+	return nil, 0, true
+}
+
+func (mock *sharedKernelAPI) Collect() ([]string, []string) {
+	mock.store.open(mock.thash)
+	return mock.reads, mock.writes
+}
+
+func TestSchedulerKernelAPI(t *testing.T) {
+	writer := common.BytesToAddress([]byte("writer"))
+	reader := common.BytesToAddress([]byte("reader"))
+	api := common.BytesToAddress([]byte{0x80})
+
+	newMock := func() *mockEthCache {
+		return &mockEthCache{
+			accounts: map[string]*mockEthAccount{
+				string(writer.Bytes()): &mockEthAccount{
+					balance: new(big.Int).SetInt64(1000000),
+				},
+				string(reader.Bytes()): &mockEthAccount{
+					balance: new(big.Int).SetInt64(1000000),
+				},
+				string(newTestConfig().Coinbase.Bytes()): &mockEthAccount{
+					balance: new(big.Int),
+				},
+			},
+		}
+	}
+	write := newTestMessager(writer, &api, 0, 0, []byte{1})
+	read := newTestMessager(reader, &api, 0, 0, nil)
+
+	// The reader sees the value only if the writer comes first, in both cases
+	// the kernel API is called once per transaction in the order of the block.
+	// The first transaction waits for the second one to reach the kernel API,
+	// which it must not do before the first one is done.
+	for _, msgs := range [][]*types.Messager{{write, read}, {read, write}} {
+		store := &kernelStore{gate: make(chan struct{}), opener: msgs[1].Txhash}
+		scheduler := NewScheduler(newTestConfig(), 2, func() KernelAPI {
+			return &sharedKernelAPI{addr: api, store: store}
+		})
+		results, receipts, errs := scheduler.Run(newMock(), newMock(), msgs)
+		if len(store.calls) != len(msgs) || store.calls[0] != msgs[0].Txhash || store.calls[1] != msgs[1].Txhash {
+			t.Errorf("Checking kernel API calls failed, got %v", store.calls)
+			return
+		}
+
+		kapi := &sharedKernelAPI{addr: api, store: &kernelStore{}}
+		mock := newMock()
+		eu := NewEU(0, NewStateDBInSequentialMode(mock, mock, kapi), kapi, newTestConfig())
+		for i, msg := range msgs {
+			result, receipt, err := eu.Run(msg.Txhash, msg.Msg, *newTestConfig().Coinbase)
+			if err != nil || errs[i] != nil {
+				t.Errorf("Checking error %d failed", i)
+				return
+			}
+			if results[i].H != result.H ||
+				receipts[i].Status != receipt.Status ||
+				receipts[i].GasUsed != receipt.GasUsed ||
+				len(results[i].R.ClibReads) != len(result.R.ClibReads) ||
+				len(results[i].W.ClibWrites) != len(result.W.ClibWrites) {
+				t.Errorf("Checking result %d failed", i)
+				return
+			}
+		}
+		if msgs[0] == write && receipts[1].Status != types.ReceiptStatusSuccessful ||
+			msgs[0] == read && receipts[0].Status != types.ReceiptStatusFailed {
+			t.Error("Checking read failed")
+			return
+		}
+	}
+}
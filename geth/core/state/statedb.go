@@ -55,14 +55,17 @@ type StateDB struct {
 	thash   common.Hash
 	logs    map[common.Hash][]*types.Log
 	dirties map[common.Address]int64
+
+	accessList map[common.Address]map[common.Hash]struct{}
 }
 
 func NewStateDB(kapi core.KernelAPI) *StateDB {
 	return &StateDB{
-		kapi:    kapi,
-		db:      make(map[common.Address]*account),
-		logs:    make(map[common.Hash][]*types.Log),
-		dirties: make(map[common.Address]int64),
+		kapi:       kapi,
+		db:         make(map[common.Address]*account),
+		logs:       make(map[common.Hash][]*types.Log),
+		dirties:    make(map[common.Address]int64),
+		accessList: make(map[common.Address]map[common.Hash]struct{}),
 	}
 }
 
@@ -99,7 +102,16 @@ func (state *StateDB) SetNonce(addr common.Address, nonce uint64) {
 	state.db[addr].nonce = nonce
 }
 
+// isKernelAPI reports whether addr is a kernel API. The state may have no
+// KernelAPI.
+func (state *StateDB) isKernelAPI(addr common.Address) bool {
+	return state.kapi != nil && state.kapi.IsKernelAPI(addr)
+}
+
 func (state *StateDB) GetCodeHash(addr common.Address) common.Hash {
+	if state.isKernelAPI(addr) {
+		return crypto.Keccak256Hash(state.kapi.Code(addr))
+	}
 	if _, ok := state.db[addr]; !ok {
 		state.db[addr] = newAccount()
 	}
@@ -107,6 +119,9 @@ func (state *StateDB) GetCodeHash(addr common.Address) common.Hash {
 }
 
 func (state *StateDB) GetCode(addr common.Address) []byte {
+	if state.isKernelAPI(addr) {
+		return state.kapi.Code(addr)
+	}
 	return state.db[addr].code
 }
 
@@ -116,10 +131,7 @@ func (state *StateDB) SetCode(addr common.Address, code []byte) {
 }
 
 func (state *StateDB) GetCodeSize(addr common.Address) int {
-	if state.kapi.IsKernelAPI(addr) {
-		return 0xff
-	}
-	return len(state.db[addr].code)
+	return len(state.GetCode(addr))
 }
 
 func (state *StateDB) AddRefund(gas uint64) {
@@ -186,6 +198,48 @@ func (state *StateDB) ForEachStorage(addr common.Address, cb func(key, value com
 
 }
 
+func (state *StateDB) PrepareAccessList(sender common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
+	state.accessList = make(map[common.Address]map[common.Hash]struct{})
+	state.AddAddressToAccessList(sender)
+	if dst != nil {
+		state.AddAddressToAccessList(*dst)
+	}
+	for _, addr := range precompiles {
+		state.AddAddressToAccessList(addr)
+	}
+	for _, tuple := range list {
+		state.AddAddressToAccessList(tuple.Address)
+		for _, key := range tuple.StorageKeys {
+			state.AddSlotToAccessList(tuple.Address, key)
+		}
+	}
+}
+
+func (state *StateDB) AddressInAccessList(addr common.Address) bool {
+	_, ok := state.accessList[addr]
+	return ok || state.isKernelAPI(addr)
+}
+
+func (state *StateDB) SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool) {
+	slots, ok := state.accessList[addr]
+	if !ok {
+		return state.isKernelAPI(addr), false
+	}
+	_, slotOk = slots[slot]
+	return true, slotOk
+}
+
+func (state *StateDB) AddAddressToAccessList(addr common.Address) {
+	if _, ok := state.accessList[addr]; !ok {
+		state.accessList[addr] = make(map[common.Hash]struct{})
+	}
+}
+
+func (state *StateDB) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	state.AddAddressToAccessList(addr)
+	state.accessList[addr][slot] = struct{}{}
+}
+
 func (state *StateDB) Set(eac core.EthAccountCache, esc core.EthStorageCache) {
 
 }
@@ -195,6 +249,7 @@ func (state *StateDB) Set(eac core.EthAccountCache, esc core.EthStorageCache) {
 func (state *StateDB) Prepare(thash, bhash common.Hash, ti int) {
 	state.thash = thash
 	state.logs = make(map[common.Hash][]*types.Log)
+	state.accessList = make(map[common.Address]map[common.Hash]struct{})
 }
 
 func (state *StateDB) GetLogs(hash common.Hash) []*types.Log {
@@ -211,8 +266,10 @@ func (state *StateDB) SetBalance(addr common.Address, amount *big.Int) {
 
 func (state *StateDB) Copy() core.StateDB {
 	return &StateDB{
-		db:      state.db,
-		logs:    make(map[common.Hash][]*types.Log),
-		dirties: make(map[common.Address]int64),
+		db:         state.db,
+		kapi:       state.kapi,
+		logs:       make(map[common.Hash][]*types.Log),
+		dirties:    make(map[common.Address]int64),
+		accessList: make(map[common.Address]map[common.Hash]struct{}),
 	}
 }
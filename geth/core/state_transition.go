@@ -17,21 +17,16 @@
 package core
 
 import (
-	"errors"
-	"fmt"
 	"math"
 	"math/big"
 
 	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
 	"github.com/HPISTechnologies/mevm/geth/core/vm"
 	"github.com/HPISTechnologies/mevm/geth/log"
 	"github.com/HPISTechnologies/mevm/geth/params"
 )
 
-var (
-	errInsufficientBalanceForGas = errors.New("insufficient balance to pay for gas")
-)
-
 /*
 The State Transitioning Model
 
@@ -50,7 +45,7 @@ The state transitioning model does all the necessary work to work out a valid ne
 6) Derive new state root
 */
 type StateTransition struct {
-	// gp         *GasPool
+	gp         *GasPool
 	msg        Message
 	gas        uint64
 	gasPrice   *big.Int
@@ -59,6 +54,7 @@ type StateTransition struct {
 	data       []byte
 	state      vm.StateDB
 	evm        *vm.EVM
+	nonceCheck NonceCheck
 }
 
 // Message represents a message sent to a contract.
@@ -74,10 +70,54 @@ type Message interface {
 	Nonce() uint64
 	CheckNonce() bool
 	Data() []byte
+	AccessList() types.AccessList
+}
+
+// nonceExpecter is implemented by a StateDB that can run a message against a
+// nonce it hasn't observed yet.
+type nonceExpecter interface {
+	expectNonce(addr common.Address, nonce uint64)
+}
+
+// ExecutionResult includes all output after executing given evm
+// message no matter the execution itself is successful or not.
+type ExecutionResult struct {
+	UsedGas         uint64         // Total used gas but include the refunded gas
+	Err             error          // Any error encountered during the execution(listed in core/vm/errors.go)
+	ReturnData      []byte         // Returned data from evm(function result or data supplied with revert opcode)
+	ContractAddress common.Address // Address of the contract created by a contract creation message
+}
+
+// Unwrap returns the internal evm error which allows us for further
+// analysis outside.
+func (result *ExecutionResult) Unwrap() error {
+	return result.Err
+}
+
+// Failed returns the indicator whether the execution is successful or not
+func (result *ExecutionResult) Failed() bool { return result.Err != nil }
+
+// Return is a helper function to help caller distinguish between revert reason
+// and function return. Return returns the data after execution if no error occurs.
+func (result *ExecutionResult) Return() []byte {
+	if result.Err != nil {
+		return nil
+	}
+	return common.CopyBytes(result.ReturnData)
+}
+
+// Revert returns the concrete revert reason if the execution is aborted by `REVERT`
+// opcode. Note the reason can be nil if no data supplied with revert opcode.
+func (result *ExecutionResult) Revert() []byte {
+	if result.Err != vm.ErrExecutionReverted {
+		return nil
+	}
+	return common.CopyBytes(result.ReturnData)
 }
 
-// IntrinsicGas computes the 'intrinsic gas' for a message with the given data.
-func IntrinsicGas(data []byte, contractCreation, homestead bool) (uint64, error) {
+// IntrinsicGas computes the 'intrinsic gas' for a message with the given data
+// and access list.
+func IntrinsicGas(data []byte, accessList types.AccessList, contractCreation, homestead, istanbul bool) (uint64, error) {
 	// Set the starting gas for the raw transaction
 	var gas uint64
 	if contractCreation && homestead {
@@ -95,10 +135,14 @@ func IntrinsicGas(data []byte, contractCreation, homestead bool) (uint64, error)
 			}
 		}
 		// Make sure we don't exceed uint64 for all data combinations
-		if (math.MaxUint64-gas)/params.TxDataNonZeroGas < nz {
+		nonZeroGas := params.TxDataNonZeroGas
+		if istanbul {
+			nonZeroGas = params.TxDataNonZeroGasEIP2028
+		}
+		if (math.MaxUint64-gas)/nonZeroGas < nz {
 			return 0, vm.ErrOutOfGas
 		}
-		gas += nz * params.TxDataNonZeroGas
+		gas += nz * nonZeroGas
 
 		z := uint64(len(data)) - nz
 		if (math.MaxUint64-gas)/params.TxDataZeroGas < z {
@@ -106,31 +150,38 @@ func IntrinsicGas(data []byte, contractCreation, homestead bool) (uint64, error)
 		}
 		gas += z * params.TxDataZeroGas
 	}
+	if accessList != nil {
+		gas += uint64(len(accessList)) * params.TxAccessListAddressGas
+		gas += uint64(accessList.StorageKeys()) * params.TxAccessListStorageKeyGas
+	}
 	return gas, nil
 }
 
 // NewStateTransition initialises and returns a new state transition object.
-func NewStateTransition(evm *vm.EVM, msg Message) *StateTransition {
+func NewStateTransition(evm *vm.EVM, msg Message, gp *GasPool, nonceCheck NonceCheck) *StateTransition {
 	return &StateTransition{
-		// gp:       gp,
-		evm:      evm,
-		msg:      msg,
-		gasPrice: msg.GasPrice(),
-		value:    msg.Value(),
-		data:     msg.Data(),
-		state:    evm.StateDB,
+		gp:         gp,
+		evm:        evm,
+		msg:        msg,
+		gasPrice:   msg.GasPrice(),
+		value:      msg.Value(),
+		data:       msg.Data(),
+		state:      evm.StateDB,
+		nonceCheck: nonceCheck,
 	}
 }
 
 // ApplyMessage computes the new state by applying the given message
-// against the old state within the environment.
+// against the old state within the environment. The gas of the message is
+// bought from gp, a nil gp doesn't limit the gas.
 //
-// ApplyMessage returns the bytes returned by any EVM execution (if it took place),
-// the gas used (which includes gas refunds) and an error if it failed. An error always
-// indicates a core error meaning that the message would always fail for that particular
-// state and would never be accepted within a block.
-func ApplyMessage(evm *vm.EVM, msg Message) ([]byte, uint64, bool, error) {
-	return NewStateTransition(evm, msg).TransitionDb()
+// ApplyMessage returns the execution result of the message, including the gas
+// used (which includes gas refunds), the bytes returned by the EVM and the EVM
+// error if the execution failed. An error always indicates a core error meaning
+// that the message would always fail for that particular state and would never
+// be accepted within a block.
+func ApplyMessage(evm *vm.EVM, msg Message, gp *GasPool, nonceCheck NonceCheck) (*ExecutionResult, error) {
+	return NewStateTransition(evm, msg, gp, nonceCheck).TransitionDb()
 }
 
 // to returns the recipient of the message.
@@ -153,11 +204,13 @@ func (st *StateTransition) useGas(amount uint64) error {
 func (st *StateTransition) buyGas() error {
 	mgval := new(big.Int).Mul(new(big.Int).SetUint64(st.msg.Gas()), st.gasPrice)
 	if st.state.GetBalanceNoRecord(st.msg.From()).Cmp(mgval) < 0 {
-		return errInsufficientBalanceForGas
+		return ErrInsufficientBalanceForGas
+	}
+	if st.gp != nil {
+		if err := st.gp.SubGas(st.msg.Gas()); err != nil {
+			return err
+		}
 	}
-	// if err := st.gp.SubGas(st.msg.Gas()); err != nil {
-	// 	return err
-	// }
 	st.gas += st.msg.Gas()
 
 	st.initialGas = st.msg.Gas()
@@ -167,37 +220,52 @@ func (st *StateTransition) buyGas() error {
 
 func (st *StateTransition) preCheck() error {
 	// Make sure this transaction's nonce is correct.
-	// if st.msg.CheckNonce() {
-	// 	nonce := st.state.GetNonce(st.msg.From())
-	// 	if nonce < st.msg.Nonce() {
-	// 		return ErrNonceTooHigh
-	// 	} else if nonce > st.msg.Nonce() {
-	// 		return ErrNonceTooLow
-	// 	}
-	// }
+	if st.msg.CheckNonce() && st.nonceCheck != NonceCheckSkip {
+		nonce := st.state.GetNonce(st.msg.From())
+		if nonce > st.msg.Nonce() {
+			return ErrNonceTooLow
+		}
+		if nonce < st.msg.Nonce() {
+			if st.nonceCheck == NonceCheckStrict {
+				return ErrNonceTooHigh
+			}
+			// The nonce may be set by the transactions before it in the
+			// block, leave it to the arbitrator.
+			if state, ok := st.state.(nonceExpecter); ok {
+				state.expectNonce(st.msg.From(), st.msg.Nonce())
+			}
+		}
+	}
 	return st.buyGas()
 }
 
 // TransitionDb will transition the state by applying the current message and
-// returning the result including the used gas. It returns an error if failed.
-// An error indicates a consensus issue.
-func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bool, err error) {
-	if err = st.preCheck(); err != nil {
-		fmt.Printf("github.com/HPISTechnologies/mevm/geth/core/state_transition.go  --TransitionDb-- >> err= %v \n", err)
-		return
+// returning the evm execution result. A failed execution is reported in the
+// result, the returned error indicates a consensus issue.
+func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
+	if err := st.preCheck(); err != nil {
+		return nil, err
 	}
 	msg := st.msg
 	sender := vm.AccountRef(msg.From())
 	homestead := st.evm.ChainConfig().IsHomestead(st.evm.BlockNumber)
+	istanbul := st.evm.ChainConfig().IsIstanbul(st.evm.BlockNumber)
 	contractCreation := msg.To() == nil
 
 	// Pay intrinsic gas
-	gas, err := IntrinsicGas(st.data, contractCreation, homestead)
+	gas, err := IntrinsicGas(st.data, msg.AccessList(), contractCreation, homestead, istanbul)
 	if err != nil {
-		return nil, 0, false, err
+		st.releaseGas()
+		return nil, err
+	}
+	if st.gas < gas {
+		st.releaseGas()
+		return nil, ErrIntrinsicGas
 	}
-	if err = st.useGas(gas); err != nil {
-		return nil, 0, false, err
+	st.gas -= gas
+
+	if rules := st.evm.ChainConfig().Rules(st.evm.BlockNumber); rules.IsBerlin {
+		st.state.PrepareAccessList(msg.From(), msg.To(), st.evm.ActivePrecompiles(), msg.AccessList())
 	}
 
 	var (
@@ -205,10 +273,14 @@ func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bo
 		// vm errors do not effect consensus and are therefor
 		// not assigned to err, except for insufficient balance
 		// error.
-		vmerr error
+		ret          []byte
+		contractAddr common.Address
+		vmerr        error
 	)
 	if contractCreation {
-		ret, _, st.gas, vmerr = evm.Create(sender, st.data, st.gas, st.value)
+		// The address is derived from the nonce of the sender in the state,
+		// which may differ from the one of the message when it isn't checked.
+		ret, contractAddr, st.gas, vmerr = evm.Create(sender, st.data, st.gas, st.value)
 	} else {
 		// Increment the nonce for the next transaction
 		st.state.SetNonce(msg.From(), st.state.GetNonce(sender.Address())+1)
@@ -220,13 +292,19 @@ func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bo
 		// sufficient balance to make the transfer happen. The first
 		// balance transfer may never fail.
 		if vmerr == vm.ErrInsufficientBalance {
-			return nil, 0, false, vmerr
+			st.releaseGas()
+			return nil, vmerr
 		}
 	}
 	st.refundGas()
 	st.state.AddBalance(st.evm.Coinbase, new(big.Int).Mul(new(big.Int).SetUint64(st.gasUsed()), st.gasPrice))
 
-	return ret, st.gasUsed(), vmerr != nil, err
+	return &ExecutionResult{
+		UsedGas:         st.gasUsed(),
+		Err:             vmerr,
+		ReturnData:      ret,
+		ContractAddress: contractAddr,
+	}, nil
 }
 
 func (st *StateTransition) refundGas() {
@@ -243,7 +321,17 @@ func (st *StateTransition) refundGas() {
 
 	// Also return remaining gas to the block gas counter so it is
 	// available for the next transaction.
-	// st.gp.AddGas(st.gas)
+	if st.gp != nil {
+		st.gp.AddGas(st.gas)
+	}
+}
+
+// releaseGas returns all the gas bought to the block gas counter, the message
+// turned out to be invalid and won't be included.
+func (st *StateTransition) releaseGas() {
+	if st.gp != nil {
+		st.gp.AddGas(st.initialGas)
+	}
 }
 
 // gasUsed returns the amount of gas used up by the state transition.
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/HPISTechnologies/mevm/geth/common"
 	"github.com/HPISTechnologies/mevm/geth/core/types"
@@ -16,31 +18,56 @@ type ethState struct {
 	thash        common.Hash
 	logs         map[common.Hash][]*types.Log
 	// Reads
-	balanceReads map[common.Address]*big.Int
-	storageReads map[common.Address]struct{}
+	balanceReads   map[common.Address]*big.Int
+	storageReads   map[common.Address]map[common.Hash]common.Hash
+	nonceReads     map[common.Address]uint64
+	codeReads      map[common.Address]common.Hash
+	existenceReads map[common.Address]bool
 	// Writes
 	newlyCreated  map[common.Address]struct{}
 	balanceWrites map[common.Address]*big.Int
 	nonceWrites   map[common.Address]uint64
 	codeWrites    map[common.Address][]byte
 	storageWrites map[common.Address]map[common.Hash]common.Hash
+	suicided      map[common.Address]struct{}
 	seqMode       bool
+
+	// The addresses and storage slots accessed in the transaction (EIP-2929).
+	// An address without accessed slots maps to nil.
+	accessList map[common.Address]map[common.Hash]struct{}
+
+	// Journal of state modifications. This is the backbone of
+	// Snapshot and RevertToSnapshot.
+	journal        *journal
+	validRevisions []revision
+	nextRevisionID int
+}
+
+type revision struct {
+	id           int
+	journalIndex int
 }
 
 // NewStateDB creates an instance of ethState and returns it as an StateDB.
 func NewStateDB(eac EthAccountCache, esc EthStorageCache, kapi KernelAPI) StateDB {
 	return &ethState{
-		accountCache:  eac,
-		storageCache:  esc,
-		kapi:          kapi,
-		logs:          make(map[common.Hash][]*types.Log),
-		balanceReads:  make(map[common.Address]*big.Int),
-		storageReads:  make(map[common.Address]struct{}),
-		newlyCreated:  make(map[common.Address]struct{}),
-		balanceWrites: make(map[common.Address]*big.Int),
-		nonceWrites:   make(map[common.Address]uint64),
-		codeWrites:    make(map[common.Address][]byte),
-		storageWrites: make(map[common.Address]map[common.Hash]common.Hash),
+		accountCache:   eac,
+		storageCache:   esc,
+		kapi:           kapi,
+		logs:           make(map[common.Hash][]*types.Log),
+		balanceReads:   make(map[common.Address]*big.Int),
+		storageReads:   make(map[common.Address]map[common.Hash]common.Hash),
+		nonceReads:     make(map[common.Address]uint64),
+		codeReads:      make(map[common.Address]common.Hash),
+		existenceReads: make(map[common.Address]bool),
+		newlyCreated:   make(map[common.Address]struct{}),
+		balanceWrites:  make(map[common.Address]*big.Int),
+		nonceWrites:    make(map[common.Address]uint64),
+		codeWrites:     make(map[common.Address][]byte),
+		storageWrites:  make(map[common.Address]map[common.Hash]common.Hash),
+		suicided:       make(map[common.Address]struct{}),
+		accessList:     make(map[common.Address]map[common.Hash]struct{}),
+		journal:        newJournal(),
 	}
 }
 
@@ -65,11 +92,17 @@ func (es *ethState) Set(eac EthAccountCache, esc EthStorageCache) {
 // CreateAccount creates an empty account object.
 // It will not check if the addr exist.
 func (es *ethState) CreateAccount(addr common.Address) {
+	if _, ok := es.newlyCreated[addr]; ok {
+		return
+	}
+	es.journal.append(createAccountChange{account: &addr})
 	es.newlyCreated[addr] = struct{}{}
 }
 
 func (es *ethState) SubBalance(addr common.Address, amount *big.Int) {
-	if v, ok := es.balanceWrites[addr]; ok {
+	v, ok := es.balanceWrites[addr]
+	es.journal.append(balanceChange{account: &addr, prev: v, exists: ok})
+	if ok {
 		es.balanceWrites[addr] = new(big.Int).Sub(v, amount)
 	} else {
 		es.balanceWrites[addr] = new(big.Int).Neg(amount)
@@ -77,7 +110,9 @@ func (es *ethState) SubBalance(addr common.Address, amount *big.Int) {
 }
 
 func (es *ethState) AddBalance(addr common.Address, amount *big.Int) {
-	if v, ok := es.balanceWrites[addr]; ok {
+	v, ok := es.balanceWrites[addr]
+	es.journal.append(balanceChange{account: &addr, prev: v, exists: ok})
+	if ok {
 		es.balanceWrites[addr] = new(big.Int).Add(v, amount)
 	} else {
 		es.balanceWrites[addr] = amount
@@ -110,6 +145,8 @@ func (es *ethState) GetBalanceCommitted(addr common.Address) *big.Int {
 
 // SetBalance is for test only.
 func (es *ethState) SetBalance(addr common.Address, amount *big.Int) {
+	v, ok := es.balanceWrites[addr]
+	es.journal.append(balanceChange{account: &addr, prev: v, exists: ok})
 	es.balanceWrites[addr] = amount
 }
 
@@ -124,32 +161,67 @@ func (es *ethState) GetNonce(addr common.Address) uint64 {
 	} else {
 		nonce = acc.GetNonce()
 	}
+	if _, ok := es.nonceReads[addr]; !ok {
+		es.nonceReads[addr] = nonce
+	}
 	return nonce
 }
 
+// expectNonce sets the nonce of addr and records it as the nonce read, in place
+// of the nonce in the account cache.
+func (es *ethState) expectNonce(addr common.Address, nonce uint64) {
+	es.nonceReads[addr] = nonce
+	es.SetNonce(addr, nonce)
+}
+
 func (es *ethState) SetNonce(addr common.Address, nonce uint64) {
+	v, ok := es.nonceWrites[addr]
+	es.journal.append(nonceChange{account: &addr, prev: v, exists: ok})
 	es.nonceWrites[addr] = nonce
 }
 
 func (es *ethState) GetCodeHash(addr common.Address) common.Hash {
+	if es.isKernelAPI(addr) {
+		return crypto.Keccak256Hash(es.kapi.Code(addr))
+	}
 	if v, ok := es.codeWrites[addr]; ok {
 		return crypto.Keccak256Hash(v)
 	}
 
+	return es.getCommittedCodeHash(addr)
+}
+
+// getCommittedCodeHash returns the code hash of addr in the account cache and
+// records it in the read set.
+func (es *ethState) getCommittedCodeHash(addr common.Address) common.Hash {
 	var hash common.Hash
 	if acc, _ := es.accountCache.GetAccount(string(addr.Bytes())); acc == nil {
 		hash = common.Hash{}
 	} else {
 		hash = common.BytesToHash(acc.GetCodeHash())
 	}
+	if _, ok := es.codeReads[addr]; !ok {
+		es.codeReads[addr] = hash
+	}
 	return hash
 }
 
+// isKernelAPI reports whether addr is a kernel API. The state may have no
+// KernelAPI when it isn't used by an EU.
+func (es *ethState) isKernelAPI(addr common.Address) bool {
+	return es.kapi != nil && es.kapi.IsKernelAPI(addr)
+}
+
 func (es *ethState) GetCode(addr common.Address) []byte {
+	// The stub code of a kernel API never changes, it isn't recorded.
+	if es.isKernelAPI(addr) {
+		return es.kapi.Code(addr)
+	}
 	if v, ok := es.codeWrites[addr]; ok {
 		return v
 	}
 
+	es.getCommittedCodeHash(addr)
 	if code, _ := es.accountCache.GetCode(string(addr.Bytes())); code != nil {
 		return code
 	}
@@ -157,23 +229,22 @@ func (es *ethState) GetCode(addr common.Address) []byte {
 }
 
 func (es *ethState) SetCode(addr common.Address, code []byte) {
+	v, ok := es.codeWrites[addr]
+	es.journal.append(codeChange{account: &addr, prevcode: v, exists: ok})
 	es.codeWrites[addr] = code
 }
 
 func (es *ethState) GetCodeSize(addr common.Address) int {
-	if es.kapi.IsKernelAPI(addr) {
-		// FIXME!
-		return 0xff
-	}
-
 	return len(es.GetCode(addr))
 }
 
 func (es *ethState) AddRefund(amount uint64) {
+	es.journal.append(refundChange{prev: es.refund})
 	es.refund += amount
 }
 
 func (es *ethState) SubRefund(amount uint64) {
+	es.journal.append(refundChange{prev: es.refund})
 	es.refund -= amount
 }
 
@@ -182,9 +253,14 @@ func (es *ethState) GetRefund() uint64 {
 }
 
 func (es *ethState) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
-	value := es.storageCache.GetState(string(addr.Bytes()), key.Bytes())
-	es.storageReads[addr] = struct{}{}
-	return common.BytesToHash(value)
+	value := common.BytesToHash(es.storageCache.GetState(string(addr.Bytes()), key.Bytes()))
+	if _, ok := es.storageReads[addr]; !ok {
+		es.storageReads[addr] = make(map[common.Hash]common.Hash)
+	}
+	if _, ok := es.storageReads[addr][key]; !ok {
+		es.storageReads[addr][key] = value
+	}
+	return value
 }
 
 func (es *ethState) GetState(addr common.Address, key common.Hash) common.Hash {
@@ -201,15 +277,30 @@ func (es *ethState) SetState(addr common.Address, key, value common.Hash) {
 	if _, ok := es.storageWrites[addr]; !ok {
 		es.storageWrites[addr] = make(map[common.Hash]common.Hash)
 	}
+	v, ok := es.storageWrites[addr][key]
+	es.journal.append(storageChange{account: &addr, key: key, prevalue: v, exists: ok})
 	es.storageWrites[addr][key] = value
 }
 
+// Suicide marks the given account as suicided and clears its balance. The
+// code and storage stay readable until the end of the transaction, they are
+// cleared when the write set is committed.
 func (es *ethState) Suicide(addr common.Address) bool {
+	if !es.Exist(addr) {
+		return false
+	}
+
+	if _, ok := es.suicided[addr]; !ok {
+		es.journal.append(suicideChange{account: &addr})
+		es.suicided[addr] = struct{}{}
+	}
+	es.SubBalance(addr, es.GetBalanceNoRecord(addr))
 	return true
 }
 
 func (es *ethState) HasSuicided(addr common.Address) bool {
-	return false
+	_, ok := es.suicided[addr]
+	return ok
 }
 
 func (es *ethState) Exist(addr common.Address) bool {
@@ -218,6 +309,9 @@ func (es *ethState) Exist(addr common.Address) bool {
 	}
 
 	acc, _ := es.accountCache.GetAccount(string(addr.Bytes()))
+	if _, ok := es.existenceReads[addr]; !ok {
+		es.existenceReads[addr] = acc != nil
+	}
 	return acc != nil
 }
 
@@ -227,19 +321,35 @@ func (es *ethState) Empty(addr common.Address) bool {
 		es.GetCode(addr) == nil
 }
 
-func (es *ethState) RevertToSnapshot(id int) {
-	es.newlyCreated = make(map[common.Address]struct{})
-	es.balanceWrites = make(map[common.Address]*big.Int)
-	es.nonceWrites = make(map[common.Address]uint64)
-	es.codeWrites = make(map[common.Address][]byte)
-	es.storageWrites = make(map[common.Address]map[common.Hash]common.Hash)
+// RevertToSnapshot reverts all state changes made since the given revision.
+func (es *ethState) RevertToSnapshot(revid int) {
+	// Find the snapshot in the stack of valid snapshots.
+	idx := sort.Search(len(es.validRevisions), func(i int) bool {
+		return es.validRevisions[i].id >= revid
+	})
+	if idx == len(es.validRevisions) || es.validRevisions[idx].id != revid {
+		panic(fmt.Errorf("revision id %v cannot be reverted", revid))
+	}
+	snapshot := es.validRevisions[idx].journalIndex
+
+	// Replay the journal to undo changes and remove invalidated snapshots
+	es.journal.revert(es, snapshot)
+	es.validRevisions = es.validRevisions[:idx]
 }
 
+// Snapshot returns an identifier for the current revision of the state.
 func (es *ethState) Snapshot() int {
-	return 0
+	id := es.nextRevisionID
+	es.nextRevisionID++
+	es.validRevisions = append(es.validRevisions, revision{id, es.journal.length()})
+	if journal, ok := es.kapi.(KernelAPIJournal); ok {
+		es.journal.append(kernelSnapshotChange{id: journal.Snapshot()})
+	}
+	return id
 }
 
 func (es *ethState) AddLog(log *types.Log) {
+	es.journal.append(addLogChange{txhash: es.thash})
 	es.logs[es.thash] = append(es.logs[es.thash], log)
 }
 
@@ -251,6 +361,70 @@ func (es *ethState) ForEachStorage(addr common.Address, f func(common.Hash, comm
 
 }
 
+// PrepareAccessList clears the access list and adds the sender, the
+// destination, the precompiles and the declared access list of a transaction
+// to it. They are accessed before the transaction starts, this isn't journaled.
+func (es *ethState) PrepareAccessList(sender common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
+	es.accessList = make(map[common.Address]map[common.Hash]struct{})
+	es.accessList[sender] = nil
+	if dst != nil {
+		es.accessList[*dst] = nil
+	}
+	for _, addr := range precompiles {
+		es.accessList[addr] = nil
+	}
+	for _, tuple := range list {
+		slots := es.accessList[tuple.Address]
+		if slots == nil && len(tuple.StorageKeys) > 0 {
+			slots = make(map[common.Hash]struct{})
+		}
+		for _, key := range tuple.StorageKeys {
+			slots[key] = struct{}{}
+		}
+		es.accessList[tuple.Address] = slots
+	}
+}
+
+// AddressInAccessList reports whether addr was accessed in the transaction.
+// The kernel APIs are built in like the precompiles, they are always warm.
+func (es *ethState) AddressInAccessList(addr common.Address) bool {
+	_, ok := es.accessList[addr]
+	return ok || es.isKernelAPI(addr)
+}
+
+// SlotInAccessList reports whether addr and its storage slot were accessed in
+// the transaction.
+func (es *ethState) SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool) {
+	slots, ok := es.accessList[addr]
+	if !ok {
+		return es.isKernelAPI(addr), false
+	}
+	_, slotOk = slots[slot]
+	return true, slotOk
+}
+
+func (es *ethState) AddAddressToAccessList(addr common.Address) {
+	if _, ok := es.accessList[addr]; ok {
+		return
+	}
+	es.journal.append(accessListAddAccountChange{address: &addr})
+	es.accessList[addr] = nil
+}
+
+func (es *ethState) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	es.AddAddressToAccessList(addr)
+	slots := es.accessList[addr]
+	if _, ok := slots[slot]; ok {
+		return
+	}
+	es.journal.append(accessListAddSlotChange{address: &addr, slot: slot})
+	if slots == nil {
+		slots = make(map[common.Hash]struct{})
+		es.accessList[addr] = slots
+	}
+	slots[slot] = struct{}{}
+}
+
 func (es *ethState) Prepare(thash, bhash common.Hash, ti int) {
 	if es.seqMode {
 		es.accountCache.(*dirtyCache).localCommit(
@@ -259,18 +433,27 @@ func (es *ethState) Prepare(thash, bhash common.Hash, ti int) {
 			es.nonceWrites,
 			es.codeWrites,
 			es.storageWrites,
+			es.suicided,
 		)
 	}
 	es.thash = thash
 	es.refund = 0
 	es.balanceReads = make(map[common.Address]*big.Int)
-	es.storageReads = make(map[common.Address]struct{})
+	es.storageReads = make(map[common.Address]map[common.Hash]common.Hash)
+	es.nonceReads = make(map[common.Address]uint64)
+	es.codeReads = make(map[common.Address]common.Hash)
+	es.existenceReads = make(map[common.Address]bool)
 	es.newlyCreated = make(map[common.Address]struct{})
 	es.balanceWrites = make(map[common.Address]*big.Int)
 	es.nonceWrites = make(map[common.Address]uint64)
 	es.codeWrites = make(map[common.Address][]byte)
 	es.storageWrites = make(map[common.Address]map[common.Hash]common.Hash)
+	es.suicided = make(map[common.Address]struct{})
 	es.logs = make(map[common.Hash][]*types.Log)
+	es.accessList = make(map[common.Address]map[common.Hash]struct{})
+	es.journal = newJournal()
+	es.validRevisions = es.validRevisions[:0]
+	es.nextRevisionID = 0
 }
 
 func (es *ethState) GetLogs(hash common.Hash) []*types.Log {
@@ -279,15 +462,21 @@ func (es *ethState) GetLogs(hash common.Hash) []*types.Log {
 
 func (es *ethState) Copy() StateDB {
 	return &ethState{
-		accountCache:  es.accountCache,
-		storageCache:  es.storageCache,
-		logs:          make(map[common.Hash][]*types.Log),
-		balanceReads:  make(map[common.Address]*big.Int),
-		storageReads:  make(map[common.Address]struct{}),
-		newlyCreated:  make(map[common.Address]struct{}),
-		balanceWrites: make(map[common.Address]*big.Int),
-		nonceWrites:   make(map[common.Address]uint64),
-		codeWrites:    make(map[common.Address][]byte),
-		storageWrites: make(map[common.Address]map[common.Hash]common.Hash),
+		accountCache:   es.accountCache,
+		storageCache:   es.storageCache,
+		logs:           make(map[common.Hash][]*types.Log),
+		balanceReads:   make(map[common.Address]*big.Int),
+		storageReads:   make(map[common.Address]map[common.Hash]common.Hash),
+		nonceReads:     make(map[common.Address]uint64),
+		codeReads:      make(map[common.Address]common.Hash),
+		existenceReads: make(map[common.Address]bool),
+		newlyCreated:   make(map[common.Address]struct{}),
+		balanceWrites:  make(map[common.Address]*big.Int),
+		nonceWrites:    make(map[common.Address]uint64),
+		codeWrites:     make(map[common.Address][]byte),
+		storageWrites:  make(map[common.Address]map[common.Hash]common.Hash),
+		suicided:       make(map[common.Address]struct{}),
+		accessList:     make(map[common.Address]map[common.Hash]struct{}),
+		journal:        newJournal(),
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/types"
 )
 
 func TestSequentialModeStateDB(t *testing.T) {
@@ -100,3 +101,211 @@ func TestSequentialModeStateDB(t *testing.T) {
 		return
 	}
 }
+
+func TestStorageReads(t *testing.T) {
+	a1 := common.BytesToAddress([]byte{1})
+	s1 := string(a1.Bytes())
+	key1 := common.BytesToHash([]byte("key1"))
+	key2 := common.BytesToHash([]byte("key2"))
+	value1 := common.BytesToHash([]byte("value1"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			s1: &mockEthAccount{
+				balance: new(big.Int).SetInt64(100),
+			},
+		},
+		storages: map[string]map[string]string{
+			s1: map[string]string{
+				string(key1.Bytes()): string(value1.Bytes()),
+			},
+		},
+	}
+
+	state := NewStateDB(mock, mock, nil)
+	state.GetState(a1, key1)
+	state.SetState(a1, key2, value1)
+	// Reading a slot written by the transaction itself isn't recorded.
+	state.GetState(a1, key2)
+
+	reads := state.(*ethState).storageReads
+	if len(reads) != 1 || len(reads[a1]) != 1 || reads[a1][key1] != value1 {
+		t.Errorf("Checking storage reads failed, got %v", reads)
+		return
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	a1 := common.BytesToAddress([]byte{1})
+	a2 := common.BytesToAddress([]byte{2})
+	a3 := common.BytesToAddress([]byte{3})
+	s1 := string(a1.Bytes())
+	key1 := common.BytesToHash([]byte("key1"))
+	key2 := common.BytesToHash([]byte("key2"))
+	value1 := common.BytesToHash([]byte("value1"))
+	value2 := common.BytesToHash([]byte("value2"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			s1: &mockEthAccount{
+				balance: new(big.Int).SetInt64(100),
+			},
+		},
+	}
+
+	state := NewStateDB(mock, mock, nil)
+	state.Prepare(common.BytesToHash([]byte("tx1")), common.Hash{}, 0)
+	// Outer call frame.
+	state.SubBalance(a1, new(big.Int).SetInt64(10))
+	state.SetNonce(a1, 1)
+	state.SetState(a1, key1, value1)
+	state.AddLog(&types.Log{Address: a1})
+	outer := state.Snapshot()
+
+	// Inner call frame.
+	state.AddBalance(a1, new(big.Int).SetInt64(5))
+	state.AddBalance(a2, new(big.Int).SetInt64(5))
+	state.SetState(a1, key1, value2)
+	state.SetState(a1, key2, value2)
+	state.AddRefund(100)
+	inner := state.Snapshot()
+
+	// Innermost call frame.
+	state.CreateAccount(a3)
+	state.SetCode(a3, []byte{3})
+	state.SetNonce(a1, 2)
+	state.AddLog(&types.Log{Address: a3})
+
+	state.RevertToSnapshot(inner)
+	es := state.(*ethState)
+	if len(es.newlyCreated) != 0 ||
+		len(es.codeWrites) != 0 ||
+		state.GetNonce(a1) != 1 ||
+		len(state.GetLogs(es.thash)) != 1 {
+		t.Error("Checking revert of the innermost frame failed")
+		return
+	}
+	if state.GetBalanceNoRecord(a1).Cmp(new(big.Int).SetInt64(95)) != 0 ||
+		state.GetState(a1, key1) != value2 ||
+		state.GetRefund() != 100 {
+		t.Error("Checking inner frame after revert failed")
+		return
+	}
+
+	state.RevertToSnapshot(outer)
+	if state.GetBalanceNoRecord(a1).Cmp(new(big.Int).SetInt64(90)) != 0 ||
+		state.GetNonce(a1) != 1 ||
+		state.GetState(a1, key1) != value1 ||
+		state.GetRefund() != 0 ||
+		len(state.GetLogs(es.thash)) != 1 {
+		t.Error("Checking outer frame after revert failed")
+		return
+	}
+	if _, ok := es.balanceWrites[a2]; ok {
+		t.Error("Checking balance writes after revert failed")
+		return
+	}
+	if len(es.storageWrites[a1]) != 1 {
+		t.Error("Checking storage writes after revert failed")
+		return
+	}
+}
+
+func TestAccessList(t *testing.T) {
+	a1 := common.BytesToAddress([]byte{1})
+	a2 := common.BytesToAddress([]byte{2})
+	a3 := common.BytesToAddress([]byte{3})
+	key1 := common.BytesToHash([]byte("key1"))
+	key2 := common.BytesToHash([]byte("key2"))
+
+	mock := &mockEthCache{accounts: map[string]*mockEthAccount{}}
+	state := NewStateDB(mock, mock, nil)
+	state.Prepare(common.BytesToHash([]byte("tx1")), common.Hash{}, 0)
+	state.PrepareAccessList(a1, &a2, nil, types.AccessList{{Address: a2, StorageKeys: []common.Hash{key1}}})
+	if !state.AddressInAccessList(a1) || !state.AddressInAccessList(a2) || state.AddressInAccessList(a3) {
+		t.Error("Checking prepared addresses failed")
+		return
+	}
+	if addressOk, slotOk := state.SlotInAccessList(a2, key1); !addressOk || !slotOk {
+		t.Error("Checking prepared slot failed")
+		return
+	}
+
+	snapshot := state.Snapshot()
+	state.AddSlotToAccessList(a2, key2)
+	state.AddSlotToAccessList(a3, key1)
+	if addressOk, slotOk := state.SlotInAccessList(a3, key1); !addressOk || !slotOk {
+		t.Error("Checking added slot failed")
+		return
+	}
+
+	state.RevertToSnapshot(snapshot)
+	if _, slotOk := state.SlotInAccessList(a2, key2); slotOk || state.AddressInAccessList(a3) {
+		t.Error("Checking access list after revert failed")
+		return
+	}
+	if _, slotOk := state.SlotInAccessList(a2, key1); !slotOk {
+		t.Error("Checking prepared slot after revert failed")
+		return
+	}
+
+	state.Prepare(common.BytesToHash([]byte("tx2")), common.Hash{}, 1)
+	if state.AddressInAccessList(a1) {
+		t.Error("Checking access list of next transaction failed")
+		return
+	}
+}
+
+func TestSuicide(t *testing.T) {
+	a1 := common.BytesToAddress([]byte{1})
+	a2 := common.BytesToAddress([]byte{2})
+	s1 := string(a1.Bytes())
+	key1 := common.BytesToHash([]byte("key1"))
+	value1 := common.BytesToHash([]byte("value1"))
+
+	mock := &mockEthCache{
+		accounts: map[string]*mockEthAccount{
+			s1: &mockEthAccount{
+				balance: new(big.Int).SetInt64(100),
+			},
+		},
+		codes: map[string][]byte{
+			s1: []byte{1},
+		},
+		storages: map[string]map[string]string{
+			s1: map[string]string{
+				string(key1.Bytes()): string(value1.Bytes()),
+			},
+		},
+	}
+
+	state := NewStateDBInSequentialMode(mock, mock, nil)
+	if state.Suicide(a2) || state.HasSuicided(a2) {
+		t.Error("Checking suicide of a missing account failed")
+		return
+	}
+	if !state.Suicide(a1) || !state.HasSuicided(a1) {
+		t.Error("Checking suicide failed")
+		return
+	}
+	// The code and storage are cleared when the transaction is committed.
+	if bytes.Compare(state.GetCode(a1), []byte{1}) != 0 ||
+		state.GetState(a1, key1) != value1 ||
+		state.GetBalance(a1).Sign() != 0 {
+		t.Error("Checking acc1 before commit failed")
+		return
+	}
+
+	// Commit.
+	state.Prepare(common.Hash{}, common.Hash{}, 1)
+	if state.HasSuicided(a1) {
+		t.Error("Checking suicided after commit failed")
+		return
+	}
+	if state.GetCode(a1) != nil ||
+		state.GetState(a1, key1) != (common.Hash{}) ||
+		state.GetBalance(a1).Sign() != 0 {
+		t.Error("Checking acc1 after commit failed")
+		return
+	}
+}
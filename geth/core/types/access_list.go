@@ -0,0 +1,25 @@
+package types
+
+import (
+	"github.com/HPISTechnologies/mevm/geth/common"
+)
+
+// AccessList is the list of addresses and storage keys an EIP-2930
+// transaction declares to access.
+type AccessList []AccessTuple
+
+// AccessTuple is an address and the storage keys of it declared in an
+// AccessList.
+type AccessTuple struct {
+	Address     common.Address `json:"address"     gencodec:"required"`
+	StorageKeys []common.Hash  `json:"storageKeys" gencodec:"required"`
+}
+
+// StorageKeys returns the total number of storage keys in the access list.
+func (al AccessList) StorageKeys() int {
+	sum := 0
+	for _, tuple := range al {
+		sum += len(tuple.StorageKeys)
+	}
+	return sum
+}
@@ -8,7 +8,11 @@ import (
 
 type Reads struct {
 	BalanceReads    map[common.Address]*big.Int
-	EthStorageReads []common.Address
+	EthStorageReads map[common.Address]map[common.Hash]common.Hash
+	NonceReads      map[common.Address]uint64
+	CodeReads       map[common.Address]common.Hash
+	ExistenceReads  map[common.Address]bool
+	ClibReads       []string // Keys of the kernel API state read
 }
 
 type Writes struct {
@@ -18,12 +22,16 @@ type Writes struct {
 	NonceWrites      map[common.Address]uint64
 	CodeWrites       map[common.Address][]byte
 	EthStorageWrites map[common.Address]map[common.Hash]common.Hash
+	Suicided         []common.Address
+	ClibWrites       []string // Keys of the kernel API state written
 }
 
 type EuResult struct {
-	H       common.Hash
-	R       *Reads
-	W       *Writes
-	Status  uint64
-	GasUsed uint64
+	H          common.Hash
+	R          *Reads
+	W          *Writes
+	Status     uint64
+	GasUsed    uint64
+	ReturnData []byte // Returned data or revert reason
+	Err        error  // EVM error of a failed execution
 }
@@ -47,6 +47,7 @@ func ParseByte(data []byte) (*Messager, error) {
 			gasLimit:   mrlp.Msg.GasLimit,
 			gasPrice:   mrlp.Msg.GasPrice,
 			data:       mrlp.Msg.Data,
+			accessList: mrlp.Msg.AccessList,
 			checkNonce: mrlp.Msg.CheckNonce,
 		},
 	}
@@ -70,6 +71,7 @@ func (mi *Messager) ToByte() ([]byte, error) {
 			GasPrice:   mi.Msg.gasPrice,
 			Data:       mi.Msg.data,
 			CheckNonce: mi.Msg.checkNonce,
+			AccessList: mi.Msg.accessList,
 		},
 	}
 	return rlp.EncodeToBytes(mrlp)
@@ -84,6 +86,9 @@ type MessageRlp struct {
 	GasPrice   *big.Int
 	Data       []byte
 	CheckNonce bool
+	// AccessList swallows the rest of the list, so the messages encoded
+	// before it existed still decode.
+	AccessList AccessList `rlp:"tail"`
 }
 
 type Messagers struct {
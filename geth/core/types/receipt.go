@@ -18,8 +18,10 @@ package types
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"unsafe"
 
 	"github.com/HPISTechnologies/mevm/geth/common"
@@ -34,6 +36,8 @@ var (
 	receiptStatusSuccessfulRLP = []byte{0x01}
 )
 
+var errEmptyTypedReceipt = errors.New("empty typed receipt bytes")
+
 const (
 	// ReceiptStatusFailed is the status code of a transaction if execution failed.
 	ReceiptStatusFailed = uint64(0)
@@ -45,6 +49,7 @@ const (
 // Receipt represents the results of a transaction.
 type Receipt struct {
 	// Consensus fields
+	Type              uint8  `json:"type,omitempty"`
 	PostState         []byte `json:"root"`
 	Status            uint64 `json:"status"`
 	CumulativeGasUsed uint64 `json:"cumulativeGasUsed" gencodec:"required"`
@@ -55,6 +60,12 @@ type Receipt struct {
 	TxHash          common.Hash    `json:"transactionHash" gencodec:"required"`
 	ContractAddress common.Address `json:"contractAddress"`
 	GasUsed         uint64         `json:"gasUsed" gencodec:"required"`
+
+	// Inclusion information: These fields provide information about the inclusion of the
+	// transaction corresponding to this receipt.
+	BlockHash        common.Hash `json:"blockHash,omitempty"`
+	BlockNumber      *big.Int    `json:"blockNumber,omitempty"`
+	TransactionIndex uint        `json:"transactionIndex"`
 }
 
 type receiptMarshaling struct {
@@ -62,6 +73,8 @@ type receiptMarshaling struct {
 	Status            hexutil.Uint64
 	CumulativeGasUsed hexutil.Uint64
 	GasUsed           hexutil.Uint64
+	BlockNumber       *hexutil.Big
+	TransactionIndex  hexutil.Uint
 }
 
 // receiptRLP is the consensus encoding of a receipt.
@@ -98,14 +111,60 @@ func NewReceipt(root []byte, failed bool, cumulativeGasUsed uint64) *Receipt {
 }
 
 // EncodeRLP implements rlp.Encoder, and flattens the consensus fields of a receipt
-// into an RLP stream. If no post state is present, byzantium fork is assumed.
+// into an RLP stream. If no post state is present, byzantium fork is assumed. The
+// receipt of a typed transaction is encoded as an RLP string holding its EIP-2718
+// envelope.
 func (r *Receipt) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, &receiptRLP{r.statusEncoding(), r.CumulativeGasUsed, r.Bloom, r.Logs, r.TxHash, r.ContractAddress, r.GasUsed})
+	if r.Type == LegacyTxType {
+		return rlp.Encode(w, r.consensusData())
+	}
+	envelope, err := r.envelope()
+	if err != nil {
+		return err
+	}
+	return rlp.Encode(w, envelope)
+}
+
+// envelope returns the EIP-2718 envelope of the receipt of a typed transaction,
+// the type followed by the RLP encoding of the consensus fields.
+func (r *Receipt) envelope() ([]byte, error) {
+	payload, err := rlp.EncodeToBytes(r.consensusData())
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{r.Type}, payload...), nil
+}
+
+func (r *Receipt) consensusData() *receiptRLP {
+	return &receiptRLP{r.statusEncoding(), r.CumulativeGasUsed, r.Bloom, r.Logs, r.TxHash, r.ContractAddress, r.GasUsed}
 }
 
 // DecodeRLP implements rlp.Decoder, and loads the consensus fields of a receipt
 // from an RLP stream.
 func (r *Receipt) DecodeRLP(s *rlp.Stream) error {
+	kind, _, _ := s.Kind()
+	if kind == rlp.List {
+		return r.decodeConsensusData(s)
+	}
+
+	b, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 {
+		return errEmptyTypedReceipt
+	}
+	if b[0] != AccessListTxType {
+		return ErrTxTypeNotSupported
+	}
+	if err := r.decodeConsensusData(rlp.NewStream(bytes.NewReader(b[1:]), uint64(len(b)-1))); err != nil {
+		return err
+	}
+	r.Type = b[0]
+	return nil
+}
+
+func (r *Receipt) decodeConsensusData(s *rlp.Stream) error {
 	var dec receiptRLP
 	if err := s.Decode(&dec); err != nil {
 		return err
@@ -155,6 +214,7 @@ func (r *Receipt) Size() common.StorageSize {
 
 // ReceiptForStorage is a wrapper around a Receipt that flattens and parses the
 // entire content of a receipt, as opposed to only the consensus fields originally.
+// The type is not stored, it is the one of the transaction.
 type ReceiptForStorage Receipt
 
 // EncodeRLP implements rlp.Encoder, and flattens all content fields of a receipt
@@ -202,8 +262,17 @@ type Receipts []*Receipt
 // Len returns the number of receipts in this list.
 func (r Receipts) Len() int { return len(r) }
 
-// GetRlp returns the RLP encoding of one receipt from the list.
+// GetRlp returns the RLP encoding of one receipt from the list. The receipt of a
+// typed transaction is returned as its bare EIP-2718 envelope, which is what goes
+// into the receipt trie.
 func (r Receipts) GetRlp(i int) []byte {
+	if r[i].Type != LegacyTxType {
+		envelope, err := r[i].envelope()
+		if err != nil {
+			panic(err)
+		}
+		return envelope
+	}
 	bytes, err := rlp.EncodeToBytes(r[i])
 	if err != nil {
 		panic(err)
@@ -32,7 +32,15 @@ import (
 //go:generate gencodec -type txdata -field-override txdataMarshaling -out gen_tx_json.go
 
 var (
-	ErrInvalidSig = errors.New("invalid transaction v, r, s values")
+	ErrInvalidSig         = errors.New("invalid transaction v, r, s values")
+	ErrTxTypeNotSupported = errors.New("transaction type not supported")
+	errEmptyTypedTx       = errors.New("empty typed transaction bytes")
+)
+
+// Transaction types, as defined by EIP-2718.
+const (
+	LegacyTxType     = 0x00
+	AccessListTxType = 0x01
 )
 
 type Transaction struct {
@@ -56,6 +64,12 @@ type txdata struct {
 	R *big.Int `json:"r" gencodec:"required"`
 	S *big.Int `json:"s" gencodec:"required"`
 
+	// The type of the transaction, the chain ID and the access list are part
+	// of the RLP encoding of EIP-2930 transactions only.
+	Type       uint8      `json:"type"                 rlp:"-"`
+	ChainID    *big.Int   `json:"chainId,omitempty"    rlp:"-"`
+	AccessList AccessList `json:"accessList,omitempty" rlp:"-"`
+
 	// This is only used when marshaling to JSON.
 	Hash *common.Hash `json:"hash" rlp:"-"`
 }
@@ -93,6 +107,19 @@ func newTransactionTS(nonce uint64, from, to *common.Address, amount *big.Int, g
 	return &Transaction{data: d}
 }
 
+// accessListTxdata is the RLP payload of an EIP-2930 transaction.
+type accessListTxdata struct {
+	ChainID      *big.Int
+	AccountNonce uint64
+	Price        *big.Int
+	GasLimit     uint64
+	Recipient    *common.Address `rlp:"nil"`
+	Amount       *big.Int
+	Payload      []byte
+	AccessList   AccessList
+	V, R, S      *big.Int
+}
+
 type txdataMarshaling struct {
 	AccountNonce hexutil.Uint64
 	Price        *hexutil.Big
@@ -102,6 +129,28 @@ type txdataMarshaling struct {
 	V            *hexutil.Big
 	R            *hexutil.Big
 	S            *hexutil.Big
+	Type         hexTxType
+	ChainID      *hexutil.Big
+}
+
+// hexTxType marshals a transaction type as a hex quantity. Decoding rejects
+// the values above 0x7f, which EIP-2718 leaves to legacy transactions.
+type hexTxType uint8
+
+func (t hexTxType) MarshalText() ([]byte, error) {
+	return hexutil.Uint64(t).MarshalText()
+}
+
+func (t *hexTxType) UnmarshalJSON(input []byte) error {
+	var v hexutil.Uint64
+	if err := v.UnmarshalJSON(input); err != nil {
+		return err
+	}
+	if v > 0x7f {
+		return ErrTxTypeNotSupported
+	}
+	*t = hexTxType(v)
+	return nil
 }
 
 func NewTransaction(nonce uint64, to common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte) *Transaction {
@@ -137,14 +186,27 @@ func newTransaction(nonce uint64, to *common.Address, amount *big.Int, gasLimit
 	return &Transaction{data: d}
 }
 
+// NewAccessListTransaction creates an EIP-2930 transaction declaring the
+// addresses and storage keys in accessList. A nil to creates a contract.
+func NewAccessListTransaction(chainID *big.Int, nonce uint64, to *common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, accessList AccessList) *Transaction {
+	tx := newTransaction(nonce, to, amount, gasLimit, gasPrice, data)
+	tx.data.Type = AccessListTxType
+	tx.data.ChainID = new(big.Int).Set(chainID)
+	tx.data.AccessList = accessList
+	return tx
+}
+
 // ChainId returns which chain id this transaction was signed for (if at all)
 func (tx *Transaction) ChainId() *big.Int {
+	if tx.data.Type != LegacyTxType {
+		return new(big.Int).Set(tx.data.ChainID)
+	}
 	return deriveChainId(tx.data.V)
 }
 
 // Protected returns whether the transaction is protected from replay protection.
 func (tx *Transaction) Protected() bool {
-	return isProtectedV(tx.data.V)
+	return tx.data.Type != LegacyTxType || isProtectedV(tx.data.V)
 }
 
 func isProtectedV(V *big.Int) bool {
@@ -156,22 +218,96 @@ func isProtectedV(V *big.Int) bool {
 	return true
 }
 
-// EncodeRLP implements rlp.Encoder
+// EncodeRLP implements rlp.Encoder. A typed transaction is encoded as an RLP
+// string holding its EIP-2718 envelope.
 func (tx *Transaction) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, &tx.data)
+	if tx.data.Type == LegacyTxType {
+		return rlp.Encode(w, &tx.data)
+	}
+	envelope, err := tx.envelope()
+	if err != nil {
+		return err
+	}
+	return rlp.Encode(w, envelope)
 }
 
 // DecodeRLP implements rlp.Decoder
 func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
-	_, size, _ := s.Kind()
-	err := s.Decode(&tx.data)
-	if err == nil {
-		tx.size.Store(common.StorageSize(rlp.ListSize(size)))
+	kind, size, _ := s.Kind()
+	if kind == rlp.List {
+		err := s.Decode(&tx.data)
+		if err == nil {
+			tx.size.Store(common.StorageSize(rlp.ListSize(size)))
+		}
+		return err
 	}
 
+	b, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+	if err = tx.decodeTyped(b); err == nil {
+		tx.size.Store(common.StorageSize(len(b)))
+	}
 	return err
 }
 
+// envelope returns the EIP-2718 envelope of a typed transaction, the type
+// followed by the RLP payload.
+func (tx *Transaction) envelope() ([]byte, error) {
+	payload, err := rlp.EncodeToBytes(tx.typedData())
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{tx.data.Type}, payload...), nil
+}
+
+// typedData returns the RLP payload of a typed transaction.
+func (tx *Transaction) typedData() *accessListTxdata {
+	return &accessListTxdata{
+		ChainID:      tx.data.ChainID,
+		AccountNonce: tx.data.AccountNonce,
+		Price:        tx.data.Price,
+		GasLimit:     tx.data.GasLimit,
+		Recipient:    tx.data.Recipient,
+		Amount:       tx.data.Amount,
+		Payload:      tx.data.Payload,
+		AccessList:   tx.data.AccessList,
+		V:            tx.data.V,
+		R:            tx.data.R,
+		S:            tx.data.S,
+	}
+}
+
+// decodeTyped decodes the EIP-2718 envelope b of a typed transaction.
+func (tx *Transaction) decodeTyped(b []byte) error {
+	if len(b) == 0 {
+		return errEmptyTypedTx
+	}
+	if b[0] != AccessListTxType {
+		return ErrTxTypeNotSupported
+	}
+	var dec accessListTxdata
+	if err := rlp.DecodeBytes(b[1:], &dec); err != nil {
+		return err
+	}
+	tx.data = txdata{
+		AccountNonce: dec.AccountNonce,
+		Price:        dec.Price,
+		GasLimit:     dec.GasLimit,
+		Recipient:    dec.Recipient,
+		Amount:       dec.Amount,
+		Payload:      dec.Payload,
+		V:            dec.V,
+		R:            dec.R,
+		S:            dec.S,
+		Type:         b[0],
+		ChainID:      dec.ChainID,
+		AccessList:   dec.AccessList,
+	}
+	return nil
+}
+
 // MarshalJSON encodes the web3 RPC transaction format.
 func (tx *Transaction) MarshalJSON() ([]byte, error) {
 	hash := tx.Hash()
@@ -187,10 +323,22 @@ func (tx *Transaction) UnmarshalJSON(input []byte) error {
 		return err
 	}
 
+	switch dec.Type {
+	case LegacyTxType:
+	case AccessListTxType:
+		if dec.ChainID == nil {
+			return errors.New("missing required field 'chainId' in transaction")
+		}
+	default:
+		return ErrTxTypeNotSupported
+	}
+
 	withSignature := dec.V.Sign() != 0 || dec.R.Sign() != 0 || dec.S.Sign() != 0
 	if withSignature {
 		var V byte
-		if isProtectedV(dec.V) {
+		if dec.Type != LegacyTxType {
+			V = byte(dec.V.Uint64())
+		} else if isProtectedV(dec.V) {
 			chainID := deriveChainId(dec.V).Uint64()
 			V = byte(dec.V.Uint64() - 35 - 2*chainID)
 		} else {
@@ -212,6 +360,13 @@ func (tx *Transaction) Value() *big.Int    { return new(big.Int).Set(tx.data.Amo
 func (tx *Transaction) Nonce() uint64      { return tx.data.AccountNonce }
 func (tx *Transaction) CheckNonce() bool   { return true }
 
+// Type returns the EIP-2718 type of the transaction.
+func (tx *Transaction) Type() uint8 { return tx.data.Type }
+
+// AccessList returns the access list of the transaction, it is nil for a
+// legacy transaction.
+func (tx *Transaction) AccessList() AccessList { return tx.data.AccessList }
+
 // To returns the recipient address of the transaction.
 // It returns nil if the transaction is a contract creation.
 func (tx *Transaction) To() *common.Address {
@@ -222,13 +377,18 @@ func (tx *Transaction) To() *common.Address {
 	return &to
 }
 
-// Hash hashes the RLP encoding of tx.
-// It uniquely identifies the transaction.
+// Hash hashes the RLP encoding of tx, or the EIP-2718 envelope of a typed
+// transaction. It uniquely identifies the transaction.
 func (tx *Transaction) Hash() common.Hash {
 	if hash := tx.hash.Load(); hash != nil {
 		return hash.(common.Hash)
 	}
-	v := rlpHash(tx)
+	var v common.Hash
+	if tx.data.Type == LegacyTxType {
+		v = rlpHash(tx)
+	} else {
+		v = prefixedRlpHash(tx.data.Type, tx.typedData())
+	}
 	tx.hash.Store(v)
 	return v
 }
@@ -240,7 +400,12 @@ func (tx *Transaction) Size() common.StorageSize {
 		return size.(common.StorageSize)
 	}
 	c := writeCounter(0)
-	rlp.Encode(&c, &tx.data)
+	if tx.data.Type == LegacyTxType {
+		rlp.Encode(&c, &tx.data)
+	} else {
+		c = 1
+		rlp.Encode(&c, tx.typedData())
+	}
 	tx.size.Store(common.StorageSize(c))
 	return common.StorageSize(c)
 }
@@ -258,6 +423,7 @@ func (tx *Transaction) AsMessage(s Signer) (Message, error) {
 		to:         tx.data.Recipient,
 		amount:     tx.data.Amount,
 		data:       tx.data.Payload,
+		accessList: tx.data.AccessList,
 		checkNonce: true,
 	}
 
@@ -298,8 +464,14 @@ func (s Transactions) Len() int { return len(s) }
 // Swap swaps the i'th and the j'th element in s.
 func (s Transactions) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
-// GetRlp implements Rlpable and returns the i'th element of s in rlp.
+// GetRlp implements Rlpable and returns the i'th element of s in rlp. A typed
+// transaction is returned as its bare EIP-2718 envelope, which is what goes
+// into the transaction trie.
 func (s Transactions) GetRlp(i int) []byte {
+	if s[i].data.Type != LegacyTxType {
+		enc, _ := s[i].envelope()
+		return enc
+	}
 	enc, _ := rlp.EncodeToBytes(s[i])
 	return enc
 }
@@ -424,10 +596,11 @@ type Message struct {
 	gasLimit   uint64
 	gasPrice   *big.Int
 	data       []byte
+	accessList AccessList
 	checkNonce bool
 }
 
-func NewMessage(from common.Address, to *common.Address, nonce uint64, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, checkNonce bool) Message {
+func NewMessage(from common.Address, to *common.Address, nonce uint64, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, accessList AccessList, checkNonce bool) Message {
 	return Message{
 		from:       from,
 		to:         to,
@@ -436,15 +609,17 @@ func NewMessage(from common.Address, to *common.Address, nonce uint64, amount *b
 		gasLimit:   gasLimit,
 		gasPrice:   gasPrice,
 		data:       data,
+		accessList: accessList,
 		checkNonce: checkNonce,
 	}
 }
 
-func (m Message) From() common.Address { return m.from }
-func (m Message) To() *common.Address  { return m.to }
-func (m Message) GasPrice() *big.Int   { return m.gasPrice }
-func (m Message) Value() *big.Int      { return m.amount }
-func (m Message) Gas() uint64          { return m.gasLimit }
-func (m Message) Nonce() uint64        { return m.nonce }
-func (m Message) Data() []byte         { return m.data }
-func (m Message) CheckNonce() bool     { return m.checkNonce }
+func (m Message) From() common.Address   { return m.from }
+func (m Message) To() *common.Address    { return m.to }
+func (m Message) GasPrice() *big.Int     { return m.gasPrice }
+func (m Message) Value() *big.Int        { return m.amount }
+func (m Message) Gas() uint64            { return m.gasLimit }
+func (m Message) Nonce() uint64          { return m.nonce }
+func (m Message) Data() []byte           { return m.data }
+func (m Message) AccessList() AccessList { return m.accessList }
+func (m Message) CheckNonce() bool       { return m.checkNonce }
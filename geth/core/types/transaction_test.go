@@ -0,0 +1,184 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/crypto"
+	"github.com/HPISTechnologies/mevm/geth/rlp"
+)
+
+// rlpList is a list going into a trie keyed by the RLP encoding of the index.
+type rlpList interface {
+	Len() int
+	GetRlp(i int) []byte
+}
+
+// deriveRoot returns the root of the Merkle Patricia trie of list.
+func deriveRoot(list rlpList) common.Hash {
+	keys := make([][]byte, list.Len())
+	values := make([][]byte, list.Len())
+	for i := range keys {
+		key, _ := rlp.EncodeToBytes(uint(i))
+		keys[i] = make([]byte, 0, 2*len(key))
+		for _, b := range key {
+			keys[i] = append(keys[i], b>>4, b&0x0f)
+		}
+		values[i] = list.GetRlp(i)
+	}
+	return common.BytesToHash(crypto.Keccak256(trieNode(keys, values, 0)))
+}
+
+// trieNode encodes the node holding the nibble keys from depth on.
+func trieNode(keys, values [][]byte, depth int) []byte {
+	var node interface{}
+	switch {
+	case len(keys) == 0:
+		node = []byte{}
+	case len(keys) == 1:
+		node = []interface{}{compactKey(keys[0][depth:], true), values[0]}
+	default:
+		prefix := len(keys[0]) - depth
+		for _, key := range keys[1:] {
+			n := 0
+			for n < prefix && depth+n < len(key) && key[depth+n] == keys[0][depth+n] {
+				n++
+			}
+			prefix = n
+		}
+		if prefix > 0 {
+			node = []interface{}{compactKey(keys[0][depth:depth+prefix], false), childRef(trieNode(keys, values, depth+prefix))}
+			break
+		}
+		branch := make([]interface{}, 17)
+		branch[16] = []byte{}
+		for nibble := byte(0); nibble < 16; nibble++ {
+			var childKeys, childValues [][]byte
+			for i, key := range keys {
+				if len(key) == depth {
+					branch[16] = values[i]
+				} else if key[depth] == nibble {
+					childKeys, childValues = append(childKeys, key), append(childValues, values[i])
+				}
+			}
+			branch[nibble] = childRef(trieNode(childKeys, childValues, depth+1))
+		}
+		node = branch
+	}
+	enc, _ := rlp.EncodeToBytes(node)
+	return enc
+}
+
+// compactKey returns the hex prefix encoding of the nibbles.
+func compactKey(nibbles []byte, leaf bool) []byte {
+	flag := byte(0)
+	if leaf {
+		flag = 2
+	}
+	if len(nibbles)%2 == 1 {
+		nibbles = append([]byte{flag + 1}, nibbles...)
+	} else {
+		nibbles = append([]byte{flag, 0}, nibbles...)
+	}
+	compact := make([]byte, len(nibbles)/2)
+	for i := range compact {
+		compact[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	return compact
+}
+
+// childRef embeds a node shorter than a hash and refers to the others by hash.
+func childRef(node []byte) interface{} {
+	if len(node) < 32 {
+		return rlp.RawValue(node)
+	}
+	return crypto.Keccak256(node)
+}
+
+// testTransactions are the transactions of a block holding a legacy and an
+// access list transaction.
+const testTransactions = "f90101f85f800a82c35094095e7baea6a6c7c4c2dfeb977efac326af552d870a801ba09bea4c4daac7c7c52e093e6a4c35dbbcf8856f1af7b059ba20253e70848d094fa08a8fae537ce25ed8cb5af9adac3f141af69bd515bd2ba031522df09b97dd72b1b89e01f89b01800a8301e24194095e7baea6a6c7c4c2dfeb977efac326af552d878080f838f7940000000000000000000000000000000000000001e1a0000000000000000000000000000000000000000000000000000000000000000001a03dbacc8d0259f2508625e97fdfc57cd85fdd16e5821bc2c10bdd1a52649e8335a0476e10695b183a87b0aa292a7f4b78ef0c3fbe62aa2c42c84e1d9c3da159ef14"
+
+func TestTransactionsRoot(t *testing.T) {
+	// The root is the one go-ethereum derives for the transactions.
+	enc := common.FromHex(testTransactions)
+	var txs Transactions
+	if err := rlp.DecodeBytes(enc, &txs); err != nil || len(txs) != 2 {
+		t.Errorf("Checking decoding failed, got %v", err)
+		return
+	}
+	if txs[0].Type() != LegacyTxType || txs[1].Type() != AccessListTxType {
+		t.Error("Checking types failed")
+		return
+	}
+	if txs[1].Hash() != common.HexToHash("0x554af720acf477830f996f1bc5d11e54c38aa40042aeac6f66cb66f9084a959d") {
+		t.Errorf("Checking typed hash failed, got %x", txs[1].Hash())
+		return
+	}
+	if envelope := txs.GetRlp(1); envelope[0] != AccessListTxType || crypto.Keccak256Hash(envelope) != txs[1].Hash() {
+		t.Errorf("Checking envelope failed, got %x", envelope)
+		return
+	}
+	if root := deriveRoot(txs); root != common.HexToHash("0x3cb6deb616ff113b756d426828b841be06043f4ea00138e977fc3eb290c01443") {
+		t.Errorf("Checking root failed, got %x", root)
+		return
+	}
+	if encoded, err := rlp.EncodeToBytes(txs); err != nil || !bytes.Equal(encoded, enc) {
+		t.Errorf("Checking encoding failed, got %x", encoded)
+		return
+	}
+}
+
+func TestTransactionJSON(t *testing.T) {
+	var txs Transactions
+	if err := rlp.DecodeBytes(common.FromHex(testTransactions), &txs); err != nil {
+		t.Errorf("Checking decoding failed, got %v", err)
+		return
+	}
+	enc, err := json.Marshal(txs[1])
+	if err != nil {
+		t.Errorf("Checking encoding failed, got %v", err)
+		return
+	}
+	var dec Transaction
+	if err := json.Unmarshal(enc, &dec); err != nil || dec.Type() != AccessListTxType || dec.Hash() != txs[1].Hash() {
+		t.Errorf("Checking JSON decoding failed, got %v", err)
+		return
+	}
+
+	// A type doesn't wrap around to a supported one.
+	enc = bytes.Replace(enc, []byte(`"type":"0x1"`), []byte(`"type":"0x101"`), 1)
+	if err := json.Unmarshal(enc, &dec); err == nil {
+		t.Error("Checking out of range type failed")
+		return
+	}
+}
+
+func TestTypedReceipt(t *testing.T) {
+	legacy := NewReceipt(nil, false, 21000)
+	typed := NewReceipt(nil, false, 21000)
+	typed.Type = AccessListTxType
+
+	payload := Receipts{legacy}.GetRlp(0)
+	if envelope := (Receipts{typed}).GetRlp(0); !bytes.Equal(envelope, append([]byte{AccessListTxType}, payload...)) {
+		t.Errorf("Checking envelope failed, got %x", envelope)
+		return
+	}
+
+	enc, err := rlp.EncodeToBytes(typed)
+	if err != nil {
+		t.Errorf("Checking encoding failed, got %v", err)
+		return
+	}
+	var dec Receipt
+	if err := rlp.DecodeBytes(enc, &dec); err != nil || dec.Type != AccessListTxType || dec.Status != ReceiptStatusSuccessful || dec.CumulativeGasUsed != 21000 {
+		t.Errorf("Checking decoding failed, got %v", err)
+		return
+	}
+	if err := rlp.DecodeBytes([]byte{0x80}, &dec); err != errEmptyTypedReceipt {
+		t.Errorf("Checking empty receipt failed, got %v", err)
+		return
+	}
+}
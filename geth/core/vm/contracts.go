@@ -18,11 +18,15 @@ package vm
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"math/big"
 
 	"github.com/HPISTechnologies/mevm/geth/common"
 	"github.com/HPISTechnologies/mevm/geth/common/math"
+	"github.com/HPISTechnologies/mevm/geth/crypto"
+	"github.com/HPISTechnologies/mevm/geth/crypto/blake2b"
+	"github.com/HPISTechnologies/mevm/geth/crypto/bn256"
 	"github.com/HPISTechnologies/mevm/geth/params"
 	"golang.org/x/crypto/ripemd160"
 )
@@ -37,25 +41,52 @@ type PrecompiledContract interface {
 
 // PrecompiledContractsHomestead contains the default set of pre-compiled Ethereum
 // contracts used in the Frontier and Homestead releases.
-// var PrecompiledContractsHomestead = map[common.Address]PrecompiledContract{
-// 	common.BytesToAddress([]byte{1}): &ecrecover{},
-// 	common.BytesToAddress([]byte{2}): &sha256hash{},
-// 	common.BytesToAddress([]byte{3}): &ripemd160hash{},
-// 	common.BytesToAddress([]byte{4}): &dataCopy{},
-// }
+var PrecompiledContractsHomestead = map[common.Address]PrecompiledContract{
+	common.BytesToAddress([]byte{1}): &ecrecover{},
+	common.BytesToAddress([]byte{2}): &sha256hash{},
+	common.BytesToAddress([]byte{3}): &ripemd160hash{},
+	common.BytesToAddress([]byte{4}): &dataCopy{},
+}
 
 // PrecompiledContractsByzantium contains the default set of pre-compiled Ethereum
 // contracts used in the Byzantium release.
-// var PrecompiledContractsByzantium = map[common.Address]PrecompiledContract{
-// 	common.BytesToAddress([]byte{1}): &ecrecover{},
-// 	common.BytesToAddress([]byte{2}): &sha256hash{},
-// 	common.BytesToAddress([]byte{3}): &ripemd160hash{},
-// 	common.BytesToAddress([]byte{4}): &dataCopy{},
-// 	common.BytesToAddress([]byte{5}): &bigModExp{},
-// 	common.BytesToAddress([]byte{6}): &bn256Add{},
-// 	common.BytesToAddress([]byte{7}): &bn256ScalarMul{},
-// 	common.BytesToAddress([]byte{8}): &bn256Pairing{},
-// }
+var PrecompiledContractsByzantium = map[common.Address]PrecompiledContract{
+	common.BytesToAddress([]byte{1}): &ecrecover{},
+	common.BytesToAddress([]byte{2}): &sha256hash{},
+	common.BytesToAddress([]byte{3}): &ripemd160hash{},
+	common.BytesToAddress([]byte{4}): &dataCopy{},
+	common.BytesToAddress([]byte{5}): &bigModExp{},
+	common.BytesToAddress([]byte{6}): &bn256AddByzantium{},
+	common.BytesToAddress([]byte{7}): &bn256ScalarMulByzantium{},
+	common.BytesToAddress([]byte{8}): &bn256PairingByzantium{},
+}
+
+// PrecompiledContractsIstanbul contains the default set of pre-compiled Ethereum
+// contracts used in the Istanbul release.
+var PrecompiledContractsIstanbul = map[common.Address]PrecompiledContract{
+	common.BytesToAddress([]byte{1}): &ecrecover{},
+	common.BytesToAddress([]byte{2}): &sha256hash{},
+	common.BytesToAddress([]byte{3}): &ripemd160hash{},
+	common.BytesToAddress([]byte{4}): &dataCopy{},
+	common.BytesToAddress([]byte{5}): &bigModExp{},
+	common.BytesToAddress([]byte{6}): &bn256AddIstanbul{},
+	common.BytesToAddress([]byte{7}): &bn256ScalarMulIstanbul{},
+	common.BytesToAddress([]byte{8}): &bn256PairingIstanbul{},
+	common.BytesToAddress([]byte{9}): &blake2F{},
+}
+
+// activePrecompiles returns the pre-compiled contracts of the release active
+// under rules.
+func activePrecompiles(rules params.Rules) map[common.Address]PrecompiledContract {
+	switch {
+	case rules.IsIstanbul:
+		return PrecompiledContractsIstanbul
+	case rules.IsByzantium:
+		return PrecompiledContractsByzantium
+	default:
+		return PrecompiledContractsHomestead
+	}
+}
 
 // RunPrecompiledContract runs and evaluates the output of a precompiled contract.
 func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contract) (ret []byte, err error) {
@@ -67,37 +98,37 @@ func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contr
 }
 
 // ECRECOVER implemented as a native contract.
-// type ecrecover struct{}
-
-// func (c *ecrecover) RequiredGas(input []byte) uint64 {
-// 	return params.EcrecoverGas
-// }
-
-// func (c *ecrecover) Run(input []byte) ([]byte, error) {
-// 	const ecRecoverInputLength = 128
-
-// 	input = common.RightPadBytes(input, ecRecoverInputLength)
-// 	// "input" is (hash, v, r, s), each 32 bytes
-// 	// but for ecrecover we want (r, s, v)
-
-// 	r := new(big.Int).SetBytes(input[64:96])
-// 	s := new(big.Int).SetBytes(input[96:128])
-// 	v := input[63] - 27
-
-// 	// tighter sig s values input homestead only apply to tx sigs
-// 	if !allZero(input[32:63]) || !crypto.ValidateSignatureValues(v, r, s, false) {
-// 		return nil, nil
-// 	}
-// 	// v needs to be at the end for libsecp256k1
-// 	pubKey, err := crypto.Ecrecover(input[:32], append(input[64:128], v))
-// 	// make sure the public key is a valid one
-// 	if err != nil {
-// 		return nil, nil
-// 	}
-
-// 	// the first byte of pubkey is bitcoin heritage
-// 	return common.LeftPadBytes(crypto.Keccak256(pubKey[1:])[12:], 32), nil
-// }
+type ecrecover struct{}
+
+func (c *ecrecover) RequiredGas(input []byte) uint64 {
+	return params.EcrecoverGas
+}
+
+func (c *ecrecover) Run(input []byte) ([]byte, error) {
+	const ecRecoverInputLength = 128
+
+	input = common.RightPadBytes(input, ecRecoverInputLength)
+	// "input" is (hash, v, r, s), each 32 bytes
+	// but for ecrecover we want (r, s, v)
+
+	r := new(big.Int).SetBytes(input[64:96])
+	s := new(big.Int).SetBytes(input[96:128])
+	v := input[63] - 27
+
+	// tighter sig s values input homestead only apply to tx sigs
+	if !allZero(input[32:63]) || !crypto.ValidateSignatureValues(v, r, s, false) {
+		return nil, nil
+	}
+	// v needs to be at the end for libsecp256k1
+	pubKey, err := crypto.Ecrecover(input[:32], append(input[64:128], v))
+	// make sure the public key is a valid one
+	if err != nil {
+		return nil, nil
+	}
+
+	// the first byte of pubkey is bitcoin heritage
+	return common.LeftPadBytes(crypto.Keccak256(pubKey[1:])[12:], 32), nil
+}
 
 // SHA256 implemented as a native contract.
 type sha256hash struct{}
@@ -251,63 +282,103 @@ func (c *bigModExp) Run(input []byte) ([]byte, error) {
 
 // newCurvePoint unmarshals a binary blob into a bn256 elliptic curve point,
 // returning it, or an error if the point is invalid.
-// func newCurvePoint(blob []byte) (*bn256.G1, error) {
-// 	p := new(bn256.G1)
-// 	if _, err := p.Unmarshal(blob); err != nil {
-// 		return nil, err
-// 	}
-// 	return p, nil
-// }
+func newCurvePoint(blob []byte) (*bn256.G1, error) {
+	p := new(bn256.G1)
+	if _, err := p.Unmarshal(blob); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
 // newTwistPoint unmarshals a binary blob into a bn256 elliptic curve point,
 // returning it, or an error if the point is invalid.
-// func newTwistPoint(blob []byte) (*bn256.G2, error) {
-// 	p := new(bn256.G2)
-// 	if _, err := p.Unmarshal(blob); err != nil {
-// 		return nil, err
-// 	}
-// 	return p, nil
-// }
+func newTwistPoint(blob []byte) (*bn256.G2, error) {
+	p := new(bn256.G2)
+	if _, err := p.Unmarshal(blob); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// runBn256Add implements the Bn256Add precompile, referenced by both
+// Byzantium and Istanbul operations.
+func runBn256Add(input []byte) ([]byte, error) {
+	x, err := newCurvePoint(getData(input, 0, 64))
+	if err != nil {
+		return nil, err
+	}
+	y, err := newCurvePoint(getData(input, 64, 64))
+	if err != nil {
+		return nil, err
+	}
+	res := new(bn256.G1)
+	res.Add(x, y)
+	return res.Marshal(), nil
+}
 
-// bn256Add implements a native elliptic curve point addition.
-type bn256Add struct{}
+// bn256AddByzantium implements a native elliptic curve point addition
+// conforming to Byzantium consensus rules.
+type bn256AddByzantium struct{}
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
-func (c *bn256Add) RequiredGas(input []byte) uint64 {
+func (c *bn256AddByzantium) RequiredGas(input []byte) uint64 {
 	return params.Bn256AddGas
 }
 
-// func (c *bn256Add) Run(input []byte) ([]byte, error) {
-// 	x, err := newCurvePoint(getData(input, 0, 64))
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	y, err := newCurvePoint(getData(input, 64, 64))
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	res := new(bn256.G1)
-// 	res.Add(x, y)
-// 	return res.Marshal(), nil
-// }
+func (c *bn256AddByzantium) Run(input []byte) ([]byte, error) {
+	return runBn256Add(input)
+}
+
+// bn256AddIstanbul implements a native elliptic curve point addition
+// conforming to Istanbul consensus rules.
+type bn256AddIstanbul struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bn256AddIstanbul) RequiredGas(input []byte) uint64 {
+	return params.Bn256AddGasIstanbul
+}
+
+func (c *bn256AddIstanbul) Run(input []byte) ([]byte, error) {
+	return runBn256Add(input)
+}
+
+// runBn256ScalarMul implements the Bn256ScalarMul precompile, referenced by
+// both Byzantium and Istanbul operations.
+func runBn256ScalarMul(input []byte) ([]byte, error) {
+	p, err := newCurvePoint(getData(input, 0, 64))
+	if err != nil {
+		return nil, err
+	}
+	res := new(bn256.G1)
+	res.ScalarMult(p, new(big.Int).SetBytes(getData(input, 64, 32)))
+	return res.Marshal(), nil
+}
+
+// bn256ScalarMulByzantium implements a native elliptic curve scalar
+// multiplication conforming to Byzantium consensus rules.
+type bn256ScalarMulByzantium struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bn256ScalarMulByzantium) RequiredGas(input []byte) uint64 {
+	return params.Bn256ScalarMulGas
+}
+
+func (c *bn256ScalarMulByzantium) Run(input []byte) ([]byte, error) {
+	return runBn256ScalarMul(input)
+}
 
-// bn256ScalarMul implements a native elliptic curve scalar multiplication.
-// type bn256ScalarMul struct{}
+// bn256ScalarMulIstanbul implements a native elliptic curve scalar
+// multiplication conforming to Istanbul consensus rules.
+type bn256ScalarMulIstanbul struct{}
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
-// func (c *bn256ScalarMul) RequiredGas(input []byte) uint64 {
-// 	return params.Bn256ScalarMulGas
-// }
-
-// func (c *bn256ScalarMul) Run(input []byte) ([]byte, error) {
-// 	p, err := newCurvePoint(getData(input, 0, 64))
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	res := new(bn256.G1)
-// 	res.ScalarMult(p, new(big.Int).SetBytes(getData(input, 64, 32)))
-// 	return res.Marshal(), nil
-// }
+func (c *bn256ScalarMulIstanbul) RequiredGas(input []byte) uint64 {
+	return params.Bn256ScalarMulGasIstanbul
+}
+
+func (c *bn256ScalarMulIstanbul) Run(input []byte) ([]byte, error) {
+	return runBn256ScalarMul(input)
+}
 
 var (
 	// true32Byte is returned if the bn256 pairing check succeeds.
@@ -320,39 +391,122 @@ var (
 	errBadPairingInput = errors.New("bad elliptic curve pairing size")
 )
 
-// bn256Pairing implements a pairing pre-compile for the bn256 curve
-// type bn256Pairing struct{}
+// runBn256Pairing implements the Bn256Pairing precompile, referenced by both
+// Byzantium and Istanbul operations.
+func runBn256Pairing(input []byte) ([]byte, error) {
+	// Handle some corner cases cheaply
+	if len(input)%192 > 0 {
+		return nil, errBadPairingInput
+	}
+	// Convert the input into a set of coordinates
+	var (
+		cs []*bn256.G1
+		ts []*bn256.G2
+	)
+	for i := 0; i < len(input); i += 192 {
+		c, err := newCurvePoint(input[i : i+64])
+		if err != nil {
+			return nil, err
+		}
+		t, err := newTwistPoint(input[i+64 : i+192])
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+		ts = append(ts, t)
+	}
+	// Execute the pairing checks and return the results
+	if bn256.PairingCheck(cs, ts) {
+		return true32Byte, nil
+	}
+	return false32Byte, nil
+}
+
+// bn256PairingByzantium implements a pairing pre-compile for the bn256 curve
+// conforming to Byzantium consensus rules.
+type bn256PairingByzantium struct{}
 
 // RequiredGas returns the gas required to execute the pre-compiled contract.
-// func (c *bn256Pairing) RequiredGas(input []byte) uint64 {
-// 	return params.Bn256PairingBaseGas + uint64(len(input)/192)*params.Bn256PairingPerPointGas
-// }
-
-// func (c *bn256Pairing) Run(input []byte) ([]byte, error) {
-// 	// Handle some corner cases cheaply
-// 	if len(input)%192 > 0 {
-// 		return nil, errBadPairingInput
-// 	}
-// 	// Convert the input into a set of coordinates
-// 	var (
-// 		cs []*bn256.G1
-// 		ts []*bn256.G2
-// 	)
-// 	for i := 0; i < len(input); i += 192 {
-// 		c, err := newCurvePoint(input[i : i+64])
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		t, err := newTwistPoint(input[i+64 : i+192])
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		cs = append(cs, c)
-// 		ts = append(ts, t)
-// 	}
-// 	// Execute the pairing checks and return the results
-// 	if bn256.PairingCheck(cs, ts) {
-// 		return true32Byte, nil
-// 	}
-// 	return false32Byte, nil
-// }
+func (c *bn256PairingByzantium) RequiredGas(input []byte) uint64 {
+	return params.Bn256PairingBaseGas + uint64(len(input)/192)*params.Bn256PairingPerPointGas
+}
+
+func (c *bn256PairingByzantium) Run(input []byte) ([]byte, error) {
+	return runBn256Pairing(input)
+}
+
+// bn256PairingIstanbul implements a pairing pre-compile for the bn256 curve
+// conforming to Istanbul consensus rules.
+type bn256PairingIstanbul struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bn256PairingIstanbul) RequiredGas(input []byte) uint64 {
+	return params.Bn256PairingBaseGasIstanbul + uint64(len(input)/192)*params.Bn256PairingPerPointGasIstanbul
+}
+
+func (c *bn256PairingIstanbul) Run(input []byte) ([]byte, error) {
+	return runBn256Pairing(input)
+}
+
+// blake2F implements the BLAKE2b compression function F of EIP-152.
+type blake2F struct{}
+
+const (
+	blake2FInputLength        = 213
+	blake2FFinalBlockBytes    = byte(1)
+	blake2FNonFinalBlockBytes = byte(0)
+)
+
+var (
+	errBlake2FInvalidInputLength = errors.New("invalid input length")
+	errBlake2FInvalidFinalFlag   = errors.New("invalid final flag")
+)
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *blake2F) RequiredGas(input []byte) uint64 {
+	// If the input is malformed, we can't calculate the gas, return 0 and let the
+	// actual call choke and fault.
+	if len(input) != blake2FInputLength {
+		return 0
+	}
+	return uint64(binary.BigEndian.Uint32(input[0:4])) * params.Blake2FRoundGas
+}
+
+func (c *blake2F) Run(input []byte) ([]byte, error) {
+	// Make sure the input is valid (correct length and final flag)
+	if len(input) != blake2FInputLength {
+		return nil, errBlake2FInvalidInputLength
+	}
+	if input[212] != blake2FNonFinalBlockBytes && input[212] != blake2FFinalBlockBytes {
+		return nil, errBlake2FInvalidFinalFlag
+	}
+	// Parse the input into the Blake2b call parameters
+	var (
+		rounds = binary.BigEndian.Uint32(input[0:4])
+		final  = input[212] == blake2FFinalBlockBytes
+
+		h [8]uint64
+		m [16]uint64
+		t [2]uint64
+	)
+	for i := 0; i < 8; i++ {
+		offset := 4 + i*8
+		h[i] = binary.LittleEndian.Uint64(input[offset : offset+8])
+	}
+	for i := 0; i < 16; i++ {
+		offset := 68 + i*8
+		m[i] = binary.LittleEndian.Uint64(input[offset : offset+8])
+	}
+	t[0] = binary.LittleEndian.Uint64(input[196:204])
+	t[1] = binary.LittleEndian.Uint64(input[204:212])
+
+	// Execute the compression function, extract and return the result
+	blake2b.F(&h, m, t, final, rounds)
+
+	output := make([]byte, 64)
+	for i := 0; i < 8; i++ {
+		offset := i * 8
+		binary.LittleEndian.PutUint64(output[offset:offset+8], h[i])
+	}
+	return output, nil
+}
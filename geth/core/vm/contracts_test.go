@@ -0,0 +1,169 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/params"
+)
+
+// precompiledTest is a call to a pre-compiled contract. The vectors are the
+// ones of go-ethereum and of the EIPs introducing the contracts.
+type precompiledTest struct {
+	name     string
+	input    string
+	expected string
+	gas      uint64
+	err      string // Error returned by Run, if any
+}
+
+// The first word of the ecrecover input is both the hash and r.
+const ecrecoverInput = "38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e000000000000000000000000000000000000000000000000000000000000001b38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e789d1dd423d25f0772d2748d60f7e4b81bb14d086eba8e8e8efb6dcff8a4ae02"
+
+var hashTests = map[byte][]precompiledTest{
+	1: {
+		{"ecrecover", ecrecoverInput, "000000000000000000000000ceaccac640adf55b2028469bd36ba501f28b699d", params.EcrecoverGas, ""},
+		// v is neither 27 nor 28.
+		{"ecrecover invalid v", ecrecoverInput[:126] + "1d" + ecrecoverInput[128:], "", params.EcrecoverGas, ""},
+	},
+	2: {
+		{"sha256", ecrecoverInput, "811c7003375852fabd0d362e40e68607a12bdabae61a7d068fe5fdd1dbbf2a5d", params.Sha256BaseGas + 4*params.Sha256PerWordGas, ""},
+		{"sha256 empty", "", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", params.Sha256BaseGas, ""},
+	},
+	3: {
+		{"ripemd160", ecrecoverInput, "0000000000000000000000009215b8d9882ff46f0dfde6684d78e831467f65e6", params.Ripemd160BaseGas + 4*params.Ripemd160PerWordGas, ""},
+	},
+	4: {
+		{"identity", ecrecoverInput, ecrecoverInput, params.IdentityBaseGas + 4*params.IdentityPerWordGas, ""},
+		{"identity empty", "", "", params.IdentityBaseGas, ""},
+	},
+}
+
+// The gas of modexp is the one of EIP-198: mult_complexity(max(len(B),
+// len(M))) * max(adjusted_exponent_length, 1) / 20.
+var modExpTests = []precompiledTest{
+	// 3^(p-1) mod p, as in EIP-198.
+	{"modexp eip198 1", "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000002003fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2efffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", "0000000000000000000000000000000000000000000000000000000000000001", 32 * 32 * 255 / 20, ""},
+	// An empty base is 0.
+	{"modexp eip198 2", "000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000020fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2dfffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", "0000000000000000000000000000000000000000000000000000000000000000", 32 * 32 * 255 / 20, ""},
+	// 64 byte operands and a 40 byte exponent, the adjusted exponent length
+	// is 8*(40-32) plus the index of the highest bit of its first word.
+	{"modexp long exponent", "0000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000002800000000000000000000000000000000000000000000000000000000000000402291d8cdc310411e7ec27378a661c935187c07e4d5636e9bc3c400b27244b8cd3a97f11ae651070506a68a02f0e161af37f86cb9078738c370f07e8d3b583bad38c275f34aed056ad6ea8eeca4192fa1feb9dc4b1ebe55e5b8f9b680eff76c81d4e9ab304d4896f9e17fd8f0816496da087a3ebecc676aaa2c5d8ce1b3c6acbc5f1670a9821bc72985d7645e7dbb07780b4eb4d9fb9d979464a52b2b803afb03c5338aebdc8c3b67", "c5fcf5ef905ae27f41e3cc78171638ca7dd62d8416885d377e5567bc25bf656b8431ebfbf0ddb694ff22d31430ad8a82fb5514b895711b9ae01dc8d288b1dd7f", 64 * 64 * (8*8 + 253) / 20, ""},
+	// The modulus is missing from the input, it is 0.
+	{"modexp zero modulus", "0000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000010202", "00", 1 * 1 * 1 / 20, ""},
+}
+
+const (
+	bn256G1    = "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002"
+	bn256NegG1 = "000000000000000000000000000000000000000000000000000000000000000130644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd45"
+	bn256G2    = "198e9393920d483a7260bfb731fb5d25f1aa493335a9e71297e485b7aef312c21800deef121f1e76426a00665e5c4479674322d4f75edadd46debd5cd992f6ed090689d0585ff075ec9e99ad690c3395bc4b313370b38ef355acdadcd122975b12c85ea5db8c6deb4aab71808dcb408fe3d1e7690c43d37b4ce6cc0166fa7daa"
+)
+
+// bn256Tests returns the bn256 vectors with the gas prices of add, mul and
+// pairing.
+func bn256Tests(add, mul, pairingBase, pairingPerPoint uint64) map[byte][]precompiledTest {
+	return map[byte][]precompiledTest{
+		6: {
+			{"bn256Add G+G", bn256G1 + bn256G1, "030644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd315ed738c0e0a7c92e7845f96b2ae9c0a68a6a449e3538fc7ff3ebf7a5a18a2c4", add, ""},
+			{"bn256Add infinity", "", "00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000", add, ""},
+			{"bn256Add invalid point", bn256G1[:126] + "03" + bn256G1, "", add, "bn256: malformed point"},
+		},
+		7: {
+			{"bn256ScalarMul 2G", bn256G1 + "0000000000000000000000000000000000000000000000000000000000000002", "030644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd315ed738c0e0a7c92e7845f96b2ae9c0a68a6a449e3538fc7ff3ebf7a5a18a2c4", mul, ""},
+			{"bn256ScalarMul 123456789G", bn256G1 + "00000000000000000000000000000000000000000000000000000000075bcd15", "142a7688cf05c29f7593351e1b86eb87e3ad5dcb1b0fc3d853e9852040c57019136b5d7e238ae6edc22d1fba5a2dcde8a7b0df53b0c4af7f600e6a0c4610c899", mul, ""},
+		},
+		8: {
+			{"bn256Pairing empty", "", "0000000000000000000000000000000000000000000000000000000000000001", pairingBase, ""},
+			{"bn256Pairing e(G1,G2)e(-G1,G2)", bn256G1 + bn256G2 + bn256NegG1 + bn256G2, "0000000000000000000000000000000000000000000000000000000000000001", pairingBase + 2*pairingPerPoint, ""},
+			{"bn256Pairing e(G1,G2)e(G1,G2)", bn256G1 + bn256G2 + bn256G1 + bn256G2, "0000000000000000000000000000000000000000000000000000000000000000", pairingBase + 2*pairingPerPoint, ""},
+			{"bn256Pairing bad size", bn256G1 + bn256G2[:128], "", pairingBase, "bad elliptic curve pairing size"},
+		},
+	}
+}
+
+// The blake2F vectors are the ones of EIP-152, the compression of "abc".
+var blake2FTests = []precompiledTest{
+	{"blake2F 12 rounds", "0000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000001", "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923", 12, ""},
+	{"blake2F 0 rounds", "0000000048c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000001", "08c9bcf367e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d282e6ad7f520e511f6c3e2b8c68059b9442be0454267ce079217e1319cde05b", 0, ""},
+	{"blake2F not final", "0000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000000", "75ab69d3190a562c51aef8d88f1c2775876944407270c42c9844252c26d2875298743e7f6d5ea2f2d3e8d226039cd31b4e426ac4f2d3d666a610c2116fde4735", 12, ""},
+	{"blake2F 1 round", "0000000148c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000001", "b63a380cb2897d521994a85234ee2c181b5f844d2c624c002677e9703449d2fba551b3a8333bcdf5f2f7e08993d53923de3d64fcc68c034e717b9293fed7a421", 1, ""},
+	{"blake2F short input", "0000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b616263000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000003000000000000000000000000000000", "", 0, "invalid input length"},
+	{"blake2F long input", "0000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b6162630000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000030000000000000000000000000000000100", "", 0, "invalid input length"},
+	{"blake2F invalid final flag", "0000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b61626300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000002", "", 12, "invalid final flag"},
+}
+
+func TestPrecompiledContracts(t *testing.T) {
+	byzantium := bn256Tests(params.Bn256AddGas, params.Bn256ScalarMulGas, params.Bn256PairingBaseGas, params.Bn256PairingPerPointGas)
+	byzantium[5] = modExpTests
+	istanbul := bn256Tests(params.Bn256AddGasIstanbul, params.Bn256ScalarMulGasIstanbul, params.Bn256PairingBaseGasIstanbul, params.Bn256PairingPerPointGasIstanbul)
+	istanbul[5] = modExpTests
+	istanbul[9] = blake2FTests
+	for addr, tests := range hashTests {
+		byzantium[addr] = tests
+		istanbul[addr] = tests
+	}
+
+	for _, set := range []struct {
+		name      string
+		contracts map[common.Address]PrecompiledContract
+		tests     map[byte][]precompiledTest
+	}{
+		{"Homestead", PrecompiledContractsHomestead, hashTests},
+		{"Byzantium", PrecompiledContractsByzantium, byzantium},
+		{"Istanbul", PrecompiledContractsIstanbul, istanbul},
+	} {
+		if len(set.contracts) != len(set.tests) {
+			t.Errorf("Checking contracts of %s failed, got %d", set.name, len(set.contracts))
+			return
+		}
+		for addr, tests := range set.tests {
+			p := set.contracts[common.BytesToAddress([]byte{addr})]
+			if p == nil {
+				t.Errorf("Checking contract %d of %s failed", addr, set.name)
+				return
+			}
+			for _, test := range tests {
+				if !testPrecompiled(t, p, test) {
+					t.Errorf("Checking %s in %s failed", test.name, set.name)
+					return
+				}
+			}
+		}
+	}
+}
+
+// testPrecompiled runs test with exactly the gas it requires, then with one
+// less.
+func testPrecompiled(t *testing.T, p PrecompiledContract, test precompiledTest) bool {
+	input := common.Hex2Bytes(test.input)
+	if gas := p.RequiredGas(input); gas != test.gas {
+		t.Logf("required gas %d, expected %d", gas, test.gas)
+		return false
+	}
+
+	contract := NewContract(AccountRef(common.Address{}), AccountRef(common.Address{}), new(big.Int), test.gas)
+	ret, err := RunPrecompiledContract(p, input, contract)
+	if test.err != "" {
+		if err == nil || err.Error() != test.err {
+			t.Logf("error %v, expected %s", err, test.err)
+			return false
+		}
+	} else if err != nil || !bytes.Equal(ret, common.Hex2Bytes(test.expected)) {
+		t.Logf("output %x, error %v", ret, err)
+		return false
+	}
+	if contract.Gas != 0 {
+		return false
+	}
+
+	if test.gas > 0 {
+		contract = NewContract(AccountRef(common.Address{}), AccountRef(common.Address{}), new(big.Int), test.gas-1)
+		if _, err := RunPrecompiledContract(p, input, contract); err != ErrOutOfGas {
+			t.Logf("error %v with too little gas", err)
+			return false
+		}
+	}
+	return true
+}
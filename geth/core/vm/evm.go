@@ -42,15 +42,11 @@ type (
 
 // run runs the given contract and takes care of running precompiles with a fallback to the byte code interpreter.
 func run(evm *EVM, contract *Contract, input []byte, readOnly bool) ([]byte, error) {
-	// if contract.CodeAddr != nil {
-	// 	precompiles := PrecompiledContractsHomestead
-	// 	if evm.ChainConfig().IsByzantium(evm.BlockNumber) {
-	// 		precompiles = PrecompiledContractsByzantium
-	// 	}
-	// 	if p := precompiles[*contract.CodeAddr]; p != nil {
-	// 		return RunPrecompiledContract(p, input, contract)
-	// 	}
-	// }
+	if contract.CodeAddr != nil {
+		if p := evm.precompile(*contract.CodeAddr); p != nil {
+			return RunPrecompiledContract(p, input, contract)
+		}
+	}
 	for _, interpreter := range evm.interpreters {
 		if interpreter.CanRun(contract.Code) {
 			if evm.interpreter != interpreter {
@@ -166,6 +162,16 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig *params.ChainConfig, vmCon
 	return evm
 }
 
+// SetContext replaces the context of the EVM, which allows it to be reused for
+// another block. The chain rules and the interpreter are recomputed from the
+// new block number, so the gas and jump tables follow the fork of the block.
+func (evm *EVM) SetContext(ctx Context) {
+	evm.Context = ctx
+	evm.chainRules = evm.chainConfig.Rules(ctx.BlockNumber)
+	evm.interpreters = append(evm.interpreters[:0], NewEVMInterpreter(evm, evm.vmConfig))
+	evm.interpreter = evm.interpreters[0]
+}
+
 // Cancel cancels any running EVM operation. This may be called concurrently and
 // it's safe to be called multiple times.
 func (evm *EVM) Cancel() {
@@ -196,12 +202,26 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	}
 
 	if evm.kapi.IsKernelAPI(addr) {
-		// TODO: calculate gas cost.
-		ret, ok := evm.kapi.Call(caller.Address(), addr, input, evm.Origin, evm.StateDB.GetNonce(evm.Origin), evm.GetHash(new(big.Int).Sub(evm.BlockNumber, big1).Uint64()))
-		if !ok {
-			return ret, gas, errExecutionReverted
+		// The value is transferred to the kernel API address and given back
+		// if the call fails, as for a contract.
+		snapshot := evm.StateDB.Snapshot()
+		if value.Sign() > 0 {
+			evm.Transfer(evm.StateDB, caller.Address(), addr, value)
+		}
+		ret, leftOverGas, err = evm.callKernelAPI(&KernelCall{
+			Type:     CALL,
+			Caller:   caller.Address(),
+			Address:  addr,
+			Callee:   addr,
+			Input:    input,
+			Value:    value,
+			ReadOnly: evm.readOnly(),
+			Gas:      gas,
+		})
+		if err != nil {
+			evm.StateDB.RevertToSnapshot(snapshot)
 		}
-		return ret, gas, nil
+		return ret, leftOverGas, err
 	}
 
 	var (
@@ -247,7 +267,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	// when we're in homestead this also counts for code storage gas errors.
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -275,6 +295,20 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 		return nil, gas, ErrInsufficientBalance
 	}
 
+	if evm.kapi.IsKernelAPI(addr) {
+		// The kernel API runs for the calling contract, the value stays with it.
+		return evm.callKernelAPI(&KernelCall{
+			Type:     CALLCODE,
+			Caller:   caller.Address(),
+			Address:  caller.Address(),
+			Callee:   addr,
+			Input:    input,
+			Value:    value,
+			ReadOnly: evm.readOnly(),
+			Gas:      gas,
+		})
+	}
+
 	var (
 		snapshot = evm.StateDB.Snapshot()
 		to       = AccountRef(caller.Address())
@@ -288,7 +322,7 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	ret, err = run(evm, contract, input, false)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -309,6 +343,25 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 		return nil, gas, ErrDepth
 	}
 
+	if evm.kapi.IsKernelAPI(addr) {
+		// The kernel API runs for the calling contract, with its caller and
+		// value.
+		from, value := caller.Address(), new(big.Int)
+		if parent, ok := caller.(*Contract); ok {
+			from, value = parent.CallerAddress, parent.value
+		}
+		return evm.callKernelAPI(&KernelCall{
+			Type:     DELEGATECALL,
+			Caller:   from,
+			Address:  caller.Address(),
+			Callee:   addr,
+			Input:    input,
+			Value:    value,
+			ReadOnly: evm.readOnly(),
+			Gas:      gas,
+		})
+	}
+
 	var (
 		snapshot = evm.StateDB.Snapshot()
 		to       = AccountRef(caller.Address())
@@ -321,13 +374,64 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	ret, err = run(evm, contract, input, false)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
 	return ret, contract.Gas, err
 }
 
+// callKernelAPI executes a call to a kernel API and charges the gas it reports.
+// The writes of a failed call are reverted with the snapshot of the StateDB.
+func (evm *EVM) callKernelAPI(call *KernelCall) (ret []byte, leftOverGas uint64, err error) {
+	call.Origin = evm.Origin
+	call.Nonce = evm.StateDB.GetNonce(evm.Origin)
+	call.BlockHash = evm.GetHash(new(big.Int).Sub(evm.BlockNumber, big1).Uint64())
+
+	snapshot := evm.StateDB.Snapshot()
+	ret, used, ok := evm.kapi.Call(call)
+	if used > call.Gas {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		return nil, 0, ErrOutOfGas
+	}
+	if !ok {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		return ret, call.Gas - used, ErrExecutionReverted
+	}
+	return ret, call.Gas - used, nil
+}
+
+// readOnly reports whether the current call runs in a static context.
+func (evm *EVM) readOnly() bool {
+	in, ok := evm.interpreter.(*EVMInterpreter)
+	return ok && in.readOnly
+}
+
+// precompile returns the pre-compiled contract at addr, either configured in
+// vmConfig or of the release of the current block, or nil if there is none.
+func (evm *EVM) precompile(addr common.Address) PrecompiledContract {
+	if p, ok := evm.vmConfig.Precompiles[addr]; ok {
+		return p
+	}
+	return activePrecompiles(evm.chainRules)[addr]
+}
+
+// ActivePrecompiles returns the addresses of the precompiled contracts of the
+// EVM, including the ones of the config.
+func (evm *EVM) ActivePrecompiles() []common.Address {
+	precompiles := activePrecompiles(evm.chainRules)
+	addrs := make([]common.Address, 0, len(precompiles)+len(evm.vmConfig.Precompiles))
+	for addr := range precompiles {
+		addrs = append(addrs, addr)
+	}
+	for addr := range evm.vmConfig.Precompiles {
+		if _, ok := precompiles[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
 // StaticCall executes the contract associated with the addr with the given input
 // as parameters while disallowing any modifications to the state during the call.
 // Opcodes that attempt to perform such modifications will result in exceptions
@@ -342,12 +446,16 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	}
 
 	if evm.kapi.IsKernelAPI(addr) {
-		// TODO: calculate gas cost.
-		ret, ok := evm.kapi.Call(caller.Address(), addr, input, evm.Origin, evm.StateDB.GetNonce(evm.Origin), evm.GetHash(new(big.Int).Sub(evm.BlockNumber, big1).Uint64()))
-		if !ok {
-			return ret, gas, errExecutionReverted
-		}
-		return ret, gas, nil
+		return evm.callKernelAPI(&KernelCall{
+			Type:     STATICCALL,
+			Caller:   caller.Address(),
+			Address:  addr,
+			Callee:   addr,
+			Input:    input,
+			Value:    new(big.Int),
+			ReadOnly: true,
+			Gas:      gas,
+		})
 	}
 
 	var (
@@ -366,7 +474,7 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	ret, err = run(evm, contract, input, true)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -397,6 +505,10 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	}
 	nonce := evm.StateDB.GetNonce(caller.Address())
 	evm.StateDB.SetNonce(caller.Address(), nonce+1)
+	// The address is accessed even if the creation fails (EIP-2929).
+	if evm.chainRules.IsBerlin {
+		evm.StateDB.AddAddressToAccessList(address)
+	}
 
 	// Ensure there's no existing contract already at the designated address
 	contractHash := evm.StateDB.GetCodeHash(address)
@@ -448,7 +560,7 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	// when we're in homestead this also counts for code storage gas errors.
 	if maxCodeSizeExceeded || (err != nil && (evm.ChainConfig().IsHomestead(evm.BlockNumber) || err != ErrCodeStoreOutOfGas)) {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -65,6 +65,20 @@ type StateDB interface {
 	AddPreimage(common.Hash, []byte)
 
 	ForEachStorage(common.Address, func(common.Hash, common.Hash) bool)
+
+	// PrepareAccessList clears the access list and adds the sender, the
+	// destination, the precompiles and the declared access list of a
+	// transaction to it (EIP-2929, EIP-2930).
+	PrepareAccessList(sender common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList)
+	// AddressInAccessList reports whether addr was accessed in the transaction.
+	AddressInAccessList(addr common.Address) bool
+	// SlotInAccessList reports whether addr and its storage slot were accessed
+	// in the transaction.
+	SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool)
+	// AddAddressToAccessList and AddSlotToAccessList are reverted with the
+	// call frame accessing them.
+	AddAddressToAccessList(addr common.Address)
+	AddSlotToAccessList(addr common.Address, slot common.Hash)
 }
 
 // CallContext provides a basic interface for the EVM calling conventions. The EVM
@@ -80,8 +94,33 @@ type CallContext interface {
 	Create(env *EVM, me ContractRef, data []byte, gas, value *big.Int) ([]byte, common.Address, error)
 }
 
+// KernelCall describes a call to a kernel API. For CALL and STATICCALL the
+// kernel API runs for its own address. For CALLCODE and DELEGATECALL it runs
+// for the calling contract, like the code of a library. The value is only
+// transferred by CALL, to the address of the kernel API.
+type KernelCall struct {
+	Type      OpCode         // CALL, CALLCODE, DELEGATECALL or STATICCALL
+	Caller    common.Address // msg.sender seen by the kernel API
+	Address   common.Address // Account the kernel API runs for
+	Callee    common.Address // Address of the kernel API
+	Input     []byte
+	Value     *big.Int // msg.value seen by the kernel API
+	ReadOnly  bool     // Whether the call must not modify any state
+	Origin    common.Address
+	Nonce     uint64      // Nonce of the origin
+	BlockHash common.Hash // Hash of the parent block
+	Gas       uint64      // Gas budget of the call
+}
+
 // KernelAPI provides system level function calls supported by Monaco platform.
 type KernelAPI interface {
 	IsKernelAPI(addr common.Address) bool
-	Call(caller, callee common.Address, input []byte, origin common.Address, nonce uint64, blockhash common.Hash) ([]byte, bool)
+	// Call runs a kernel API and returns the gas used, which may exceed the
+	// budget. The call fails with ErrOutOfGas in that case. A kernel API
+	// must not modify any state when the call is read only.
+	//
+	// The writes of a call are undone when the call, or a call frame above
+	// it, is reverted only if the kernel API implements the KernelAPIJournal
+	// of the core package, they persist otherwise.
+	Call(call *KernelCall) ([]byte, uint64, bool)
 }
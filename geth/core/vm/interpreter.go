@@ -46,6 +46,12 @@ type Config struct {
 	EWASMInterpreter string
 	// Type of the EVM interpreter
 	EVMInterpreter string
+
+	// Precompiles contains pre-compiled contracts merged over the ones of the
+	// current release, a contract replaces the default one at its address. The
+	// contracts are shared by all the EVMs created with the Config, they must
+	// be safe for concurrent use.
+	Precompiles map[common.Address]PrecompiledContract
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
@@ -97,19 +103,9 @@ type EVMInterpreter struct {
 func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
 	// We use the STOP instruction whether to see
 	// the jump table was initialised. If it was not
-	// we'll set the default jump table.
+	// we'll set the jump table of the current release.
 	if !cfg.JumpTable[STOP].valid {
-		// switch {
-		// case evm.ChainConfig().IsConstantinople(evm.BlockNumber):
-		// 	cfg.JumpTable = constantinopleInstructionSet
-		// case evm.ChainConfig().IsByzantium(evm.BlockNumber):
-		// 	cfg.JumpTable = byzantiumInstructionSet
-		// case evm.ChainConfig().IsHomestead(evm.BlockNumber):
-		// 	cfg.JumpTable = homesteadInstructionSet
-		// default:
-		// 	cfg.JumpTable = frontierInstructionSet
-		// }
-		cfg.JumpTable = constantinopleInstructionSet
+		cfg.JumpTable = *activeInstructionSet(evm.chainRules)
 	}
 
 	return &EVMInterpreter{
@@ -140,7 +136,7 @@ func (in *EVMInterpreter) enforceRestrictions(op OpCode, operation operation, st
 //
 // It's important to note that any errors returned by the interpreter should be
 // considered a revert-and-consume-all-gas operation except for
-// errExecutionReverted which means revert-and-keep-gas-left.
+// ErrExecutionReverted which means revert-and-keep-gas-left.
 func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (ret []byte, err error) {
 	if in.intPool == nil {
 		in.intPool = poolOfIntPools.get()
@@ -271,7 +267,7 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		case err != nil:
 			return nil, err
 		case operation.reverts:
-			return res, errExecutionReverted
+			return res, ErrExecutionReverted
 		case operation.halts:
 			return res, nil
 		case !operation.jumps:
@@ -55,8 +55,80 @@ var (
 	homesteadInstructionSet      = newHomesteadInstructionSet()
 	byzantiumInstructionSet      = newByzantiumInstructionSet()
 	constantinopleInstructionSet = newConstantinopleInstructionSet()
+	istanbulInstructionSet       = newIstanbulInstructionSet()
+	berlinInstructionSet         = newBerlinInstructionSet()
 )
 
+// instructionSet is the jump table of a release and the rule activating it.
+type instructionSet struct {
+	active func(params.Rules) bool
+	table  *[256]operation
+}
+
+// instructionSets holds the jump tables of the releases, the latest first. A
+// release is supported by building its jump table from the one of the previous
+// release and adding it in front.
+var instructionSets = []instructionSet{
+	{func(rules params.Rules) bool { return rules.IsBerlin }, &berlinInstructionSet},
+	{func(rules params.Rules) bool { return rules.IsIstanbul }, &istanbulInstructionSet},
+	{func(rules params.Rules) bool { return rules.IsConstantinople }, &constantinopleInstructionSet},
+	{func(rules params.Rules) bool { return rules.IsByzantium }, &byzantiumInstructionSet},
+	{func(rules params.Rules) bool { return rules.IsHomestead }, &homesteadInstructionSet},
+}
+
+// activeInstructionSet returns the jump table of the latest release active
+// under rules.
+func activeInstructionSet(rules params.Rules) *[256]operation {
+	for _, set := range instructionSets {
+		if set.active(rules) {
+			return set.table
+		}
+	}
+	return &frontierInstructionSet
+}
+
+// newBerlinInstructionSet returns the instructions up to istanbul with the
+// cold and warm accesses of EIP-2929. The warm prices are the ones of
+// params.GasTableBerlin.
+func newBerlinInstructionSet() [256]operation {
+	instructionSet := newIstanbulInstructionSet()
+	coldAccount := params.ColdAccountAccessCostEIP2929 - params.WarmStorageReadCostEIP2929
+	instructionSet[SLOAD].gasCost = gasSLoadEIP2929
+	instructionSet[SSTORE].gasCost = gasSStoreEIP2929
+	instructionSet[BALANCE].gasCost = makeGasAccountAccessEIP2929(gasBalance, 0, coldAccount)
+	instructionSet[EXTCODESIZE].gasCost = makeGasAccountAccessEIP2929(gasExtCodeSize, 0, coldAccount)
+	instructionSet[EXTCODECOPY].gasCost = makeGasAccountAccessEIP2929(gasExtCodeCopy, 0, coldAccount)
+	instructionSet[EXTCODEHASH].gasCost = makeGasAccountAccessEIP2929(gasExtCodeHash, 0, coldAccount)
+	instructionSet[CALL].gasCost = makeGasAccountAccessEIP2929(gasCall, 1, coldAccount)
+	instructionSet[CALLCODE].gasCost = makeGasAccountAccessEIP2929(gasCallCode, 1, coldAccount)
+	instructionSet[DELEGATECALL].gasCost = makeGasAccountAccessEIP2929(gasDelegateCall, 1, coldAccount)
+	instructionSet[STATICCALL].gasCost = makeGasAccountAccessEIP2929(gasStaticCall, 1, coldAccount)
+	// The beneficiary of SELFDESTRUCT had no access price before.
+	instructionSet[SELFDESTRUCT].gasCost = makeGasAccountAccessEIP2929(gasSuicide, 0, params.ColdAccountAccessCostEIP2929)
+	return instructionSet
+}
+
+// newIstanbulInstructionSet returns the frontier, homestead, byzantium,
+// constantinople and istanbul instructions. The repricing of EIP-1884 is part
+// of params.GasTableIstanbul.
+func newIstanbulInstructionSet() [256]operation {
+	instructionSet := newConstantinopleInstructionSet()
+	instructionSet[CHAINID] = operation{
+		execute:       opChainID,
+		gasCost:       constGasFunc(GasQuickStep),
+		validateStack: makeStackFunc(0, 1),
+		valid:         true,
+	}
+	instructionSet[SELFBALANCE] = operation{
+		execute:       opSelfBalance,
+		gasCost:       constGasFunc(GasFastStep),
+		validateStack: makeStackFunc(0, 1),
+		valid:         true,
+	}
+	instructionSet[SSTORE].gasCost = gasSStoreEIP2200
+	return instructionSet
+}
+
 // NewConstantinopleInstructionSet returns the frontier, homestead
 // byzantium and contantinople instructions.
 func newConstantinopleInstructionSet() [256]operation {
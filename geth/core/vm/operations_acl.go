@@ -0,0 +1,113 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/common/math"
+	"github.com/HPISTechnologies/mevm/geth/params"
+)
+
+// gasSLoadEIP2929 charges a cold SLOAD the first time a slot is accessed in
+// the transaction and a warm one afterwards.
+func gasSLoadEIP2929(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	slot := common.BigToHash(stack.Back(0))
+	if _, slotOk := evm.StateDB.SlotInAccessList(contract.Address(), slot); slotOk {
+		return params.WarmStorageReadCostEIP2929, nil
+	}
+	evm.StateDB.AddSlotToAccessList(contract.Address(), slot)
+	return params.ColdSloadCostEIP2929, nil
+}
+
+// gasSStoreEIP2929 implements the net gas metering of EIP-2200 with the
+// SLOAD_GAS replaced by the warm read cost of EIP-2929. Accessing a cold slot
+// costs a cold SLOAD on top.
+func gasSStoreEIP2929(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	// If we fail the minimum gas availability invariant, fail (0)
+	if contract.Gas <= params.SstoreSentryGasEIP2200 {
+		return 0, errSstoreSentry
+	}
+	var (
+		y, x    = stack.Back(1), stack.Back(0)
+		slot    = common.BigToHash(x)
+		current = evm.StateDB.GetState(contract.Address(), slot)
+		cost    = uint64(0)
+	)
+	if _, slotOk := evm.StateDB.SlotInAccessList(contract.Address(), slot); !slotOk {
+		cost = params.ColdSloadCostEIP2929
+		evm.StateDB.AddSlotToAccessList(contract.Address(), slot)
+	}
+	value := common.BigToHash(y)
+
+	if current == value { // noop (1)
+		return cost + params.WarmStorageReadCostEIP2929, nil
+	}
+	original := evm.StateDB.GetCommittedState(contract.Address(), slot)
+	if original == current {
+		if original == (common.Hash{}) { // create slot (2.1.1)
+			return cost + params.SstoreSetGas, nil
+		}
+		if value == (common.Hash{}) { // delete slot (2.1.2b)
+			evm.StateDB.AddRefund(params.SstoreClearRefundEIP2200)
+		}
+		return cost + (params.SstoreResetGas - params.ColdSloadCostEIP2929), nil // write existing slot (2.1.2)
+	}
+	if original != (common.Hash{}) {
+		if current == (common.Hash{}) { // recreate slot (2.2.1.1)
+			evm.StateDB.SubRefund(params.SstoreClearRefundEIP2200)
+		} else if value == (common.Hash{}) { // delete slot (2.2.1.2)
+			evm.StateDB.AddRefund(params.SstoreClearRefundEIP2200)
+		}
+	}
+	if original == value {
+		if original == (common.Hash{}) { // reset to original inexistent slot (2.2.2.1)
+			evm.StateDB.AddRefund(params.SstoreSetGas - params.WarmStorageReadCostEIP2929)
+		} else { // reset to original existing slot (2.2.2.2)
+			evm.StateDB.AddRefund((params.SstoreResetGas - params.ColdSloadCostEIP2929) - params.WarmStorageReadCostEIP2929)
+		}
+	}
+	return cost + params.WarmStorageReadCostEIP2929, nil // dirty update (2.2)
+}
+
+// makeGasAccountAccessEIP2929 adds surcharge to the gas of old the first time
+// the address at position n of the stack is accessed in the transaction. The
+// surcharge is withheld from the contract while old runs, so a call is passed
+// the gas left after paying for it.
+func makeGasAccountAccessEIP2929(old gasFunc, n int, surcharge uint64) gasFunc {
+	return func(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+		addr := common.BigToAddress(stack.Back(n))
+		if evm.StateDB.AddressInAccessList(addr) {
+			return old(gt, evm, contract, stack, mem, memorySize)
+		}
+		evm.StateDB.AddAddressToAccessList(addr)
+
+		if contract.Gas < surcharge {
+			return 0, ErrOutOfGas
+		}
+		contract.Gas -= surcharge
+		gas, err := old(gt, evm, contract, stack, mem, memorySize)
+		contract.Gas += surcharge
+		if err != nil {
+			return 0, err
+		}
+		var overflow bool
+		if gas, overflow = math.SafeAdd(gas, surcharge); overflow {
+			return 0, errGasUintOverflow
+		}
+		return gas, nil
+	}
+}
@@ -0,0 +1,34 @@
+package blake2b
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestF(t *testing.T) {
+	// BLAKE2b-512 of "abc" is a single compression of 12 rounds.
+	h := IV
+	h[0] ^= 0x01010000 ^ 64
+
+	var (
+		block [128]byte
+		m     [16]uint64
+	)
+	copy(block[:], "abc")
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(block[i*8:])
+	}
+	F(&h, m, [2]uint64{3, 0}, true, 12)
+
+	var sum [64]byte
+	for i, v := range h {
+		binary.LittleEndian.PutUint64(sum[i*8:], v)
+	}
+	if expected := blake2b.Sum512([]byte("abc")); !bytes.Equal(sum[:], expected[:]) {
+		t.Errorf("Checking F failed, got %x", sum)
+		return
+	}
+}
@@ -0,0 +1,94 @@
+package bn256
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestG1(t *testing.T) {
+	g := new(G1).ScalarBaseMult(big.NewInt(1))
+	if g.Marshal()[31] != 1 || g.Marshal()[63] != 2 {
+		t.Errorf("Checking generator failed, got %x", g.Marshal())
+		return
+	}
+
+	// 2·(1, 2) on alt_bn128.
+	expected, _ := hex.DecodeString("030644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd315ed738c0e0a7c92e7845f96b2ae9c0a68a6a449e3538fc7ff3ebf7a5a18a2c4")
+	if sum := new(G1).Add(g, g); !bytes.Equal(sum.Marshal(), expected) {
+		t.Errorf("Checking doubling failed, got %x", sum.Marshal())
+		return
+	}
+	if mul := new(G1).ScalarMult(g, big.NewInt(2)); !bytes.Equal(mul.Marshal(), expected) {
+		t.Errorf("Checking scalar multiplication failed, got %x", mul.Marshal())
+		return
+	}
+	if inf := new(G1).ScalarMult(g, Order); !bytes.Equal(inf.Marshal(), make([]byte, 64)) {
+		t.Errorf("Checking order failed, got %x", inf.Marshal())
+		return
+	}
+
+	p2 := new(G1)
+	if rest, err := p2.Unmarshal(append(expected, 0xff)); err != nil || !bytes.Equal(rest, []byte{0xff}) {
+		t.Errorf("Checking Unmarshal failed, got %v", err)
+		return
+	}
+	if _, err := new(G1).Unmarshal(make([]byte, 64)); err != nil {
+		t.Errorf("Checking Unmarshal of infinity failed, got %v", err)
+		return
+	}
+	invalid := append([]byte{}, expected...)
+	invalid[63]++
+	if _, err := new(G1).Unmarshal(invalid); err != errMalformed {
+		t.Errorf("Checking Unmarshal of invalid point failed, got %v", err)
+		return
+	}
+	copy(invalid, p.Bytes())
+	if _, err := new(G1).Unmarshal(invalid); err != errCoordinate {
+		t.Errorf("Checking Unmarshal of large coordinate failed, got %v", err)
+		return
+	}
+}
+
+func TestG2(t *testing.T) {
+	g := new(G2).ScalarBaseMult(big.NewInt(3))
+	p2 := new(G2)
+	if _, err := p2.Unmarshal(g.Marshal()); err != nil || !bytes.Equal(p2.Marshal(), g.Marshal()) {
+		t.Errorf("Checking Unmarshal failed, got %v", err)
+		return
+	}
+	if sum := new(G2).Add(p2, p2); !bytes.Equal(sum.Marshal(), new(G2).ScalarBaseMult(big.NewInt(6)).Marshal()) {
+		t.Error("Checking doubling failed")
+		return
+	}
+
+	// (1, y) is on the twist but not in G₂.
+	point, _ := hex.DecodeString("000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000010d1271953ed9ea0836846e70a1934187998c7f790cb4d7511b7f8da82de048a42869111d5381f072f8e2728fdb825a51aadd70e52c9830e9ab4b871c0531f1bb")
+	if _, err := new(G2).Unmarshal(point); err != errNotInSubgroup {
+		t.Errorf("Checking Unmarshal of point outside G2 failed, got %v", err)
+		return
+	}
+}
+
+func TestPairingCheck(t *testing.T) {
+	a, b := big.NewInt(7), big.NewInt(11)
+	pa := new(G1).ScalarBaseMult(a)
+	qb := new(G2).ScalarBaseMult(b)
+	pab := new(G1).ScalarBaseMult(new(big.Int).Mul(a, b))
+	q := new(G2).ScalarBaseMult(big.NewInt(1))
+
+	// e(a·P, b·Q) · e(-ab·P, Q) = 1
+	if !PairingCheck([]*G1{pa, new(G1).Neg(pab)}, []*G2{qb, q}) {
+		t.Error("Checking bilinearity failed")
+		return
+	}
+	if PairingCheck([]*G1{pa, pab}, []*G2{qb, q}) {
+		t.Error("Checking failing pairing failed")
+		return
+	}
+	if !PairingCheck(nil, nil) {
+		t.Error("Checking empty pairing failed")
+		return
+	}
+}
@@ -0,0 +1,189 @@
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/common/math"
+)
+
+var (
+	errShortInput   = errors.New("kernel: input too short")
+	errInvalidInput = errors.New("kernel: invalid input")
+)
+
+var (
+	bigT     = reflect.TypeOf((*big.Int)(nil))
+	addressT = reflect.TypeOf(common.Address{})
+	hashT    = reflect.TypeOf(common.Hash{})
+	bytesT   = reflect.TypeOf([]byte(nil))
+)
+
+// abiType is the ABI type a Go type of a handler argument or result is mapped
+// to. Only the elementary types are supported, no arrays, slices other than
+// bytes or tuples.
+type abiType struct {
+	name string
+	typ  reflect.Type
+}
+
+func newABIType(typ reflect.Type) (abiType, error) {
+	switch typ {
+	case bigT:
+		return abiType{"uint256", typ}, nil
+	case addressT:
+		return abiType{"address", typ}, nil
+	case hashT:
+		return abiType{"bytes32", typ}, nil
+	case bytesT:
+		return abiType{"bytes", typ}, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return abiType{"bool", typ}, nil
+	case reflect.String:
+		return abiType{"string", typ}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return abiType{fmt.Sprintf("int%d", typ.Bits()), typ}, nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return abiType{fmt.Sprintf("uint%d", typ.Bits()), typ}, nil
+	}
+	return abiType{}, fmt.Errorf("kernel: unsupported type %v", typ)
+}
+
+// dynamic reports whether the value is encoded in the tail of the arguments.
+func (t abiType) dynamic() bool {
+	return t.typ.Kind() == reflect.String || t.typ == bytesT
+}
+
+// pack encodes values as the ABI arguments of types.
+func pack(types []abiType, values []reflect.Value) []byte {
+	var head, tail []byte
+	for i, t := range types {
+		if !t.dynamic() {
+			head = append(head, encodeStatic(t, values[i])...)
+			continue
+		}
+
+		head = append(head, math.PaddedBigBytes(big.NewInt(int64(32*len(types)+len(tail))), 32)...)
+		var data []byte
+		if t.typ == bytesT {
+			data = values[i].Bytes()
+		} else {
+			data = []byte(values[i].String())
+		}
+		tail = append(tail, math.PaddedBigBytes(big.NewInt(int64(len(data))), 32)...)
+		tail = append(tail, common.RightPadBytes(data, (len(data)+31)/32*32)...)
+	}
+	return append(head, tail...)
+}
+
+func encodeStatic(t abiType, value reflect.Value) []byte {
+	switch {
+	case t.typ == bigT:
+		if value.IsNil() {
+			return make([]byte, 32)
+		}
+		return math.PaddedBigBytes(math.U256(new(big.Int).Set(value.Interface().(*big.Int))), 32)
+	case t.typ == addressT:
+		return common.LeftPadBytes(value.Interface().(common.Address).Bytes(), 32)
+	case t.typ == hashT:
+		return value.Interface().(common.Hash).Bytes()
+	}
+
+	switch t.typ.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			return math.PaddedBigBytes(common.Big1, 32)
+		}
+		return make([]byte, 32)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return math.PaddedBigBytes(math.U256(big.NewInt(value.Int())), 32)
+	default:
+		return math.PaddedBigBytes(new(big.Int).SetUint64(value.Uint()), 32)
+	}
+}
+
+// unpack decodes the ABI arguments of types from data.
+func unpack(types []abiType, data []byte) ([]reflect.Value, error) {
+	if len(data) < 32*len(types) {
+		return nil, errShortInput
+	}
+
+	values := make([]reflect.Value, len(types))
+	for i, t := range types {
+		word := data[32*i : 32*(i+1)]
+		if !t.dynamic() {
+			value, err := decodeStatic(t, word)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+			continue
+		}
+
+		offset, err := decodeSize(word, len(data)-32)
+		if err != nil {
+			return nil, err
+		}
+		length, err := decodeSize(data[offset:offset+32], len(data)-offset-32)
+		if err != nil {
+			return nil, err
+		}
+		content := data[offset+32 : offset+32+length]
+		value := reflect.New(t.typ).Elem()
+		if t.typ == bytesT {
+			value.SetBytes(common.CopyBytes(content))
+		} else {
+			value.SetString(string(content))
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// decodeSize decodes an offset or a length, which must not exceed max.
+func decodeSize(word []byte, max int) (int, error) {
+	n := new(big.Int).SetBytes(word)
+	if !n.IsInt64() || n.Int64() > int64(max) {
+		return 0, errShortInput
+	}
+	return int(n.Int64()), nil
+}
+
+func decodeStatic(t abiType, word []byte) (reflect.Value, error) {
+	n := new(big.Int).SetBytes(word)
+	switch {
+	case t.typ == bigT:
+		return reflect.ValueOf(n), nil
+	case t.typ == addressT:
+		return reflect.ValueOf(common.BytesToAddress(word)), nil
+	case t.typ == hashT:
+		return reflect.ValueOf(common.BytesToHash(word)), nil
+	}
+
+	value := reflect.New(t.typ).Elem()
+	switch t.typ.Kind() {
+	case reflect.Bool:
+		if n.BitLen() > 1 {
+			return reflect.Value{}, errInvalidInput
+		}
+		value.SetBool(n.Sign() != 0)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = math.S256(n)
+		if !n.IsInt64() || value.OverflowInt(n.Int64()) {
+			return reflect.Value{}, errInvalidInput
+		}
+		value.SetInt(n.Int64())
+	default:
+		if !n.IsUint64() || value.OverflowUint(n.Uint64()) {
+			return reflect.Value{}, errInvalidInput
+		}
+		value.SetUint(n.Uint64())
+	}
+	return value, nil
+}
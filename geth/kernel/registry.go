@@ -0,0 +1,363 @@
+// Package kernel implements the KernelAPI of the EVM with system contracts
+// written in Go.
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core"
+	"github.com/HPISTechnologies/mevm/geth/core/vm"
+	"github.com/HPISTechnologies/mevm/geth/crypto"
+	"github.com/HPISTechnologies/mevm/geth/params"
+)
+
+var (
+	_ core.KernelAPI          = (*Registry)(nil)
+	_ core.KernelAPICollector = (*Registry)(nil)
+	_ core.KernelAPIJournal   = (*Registry)(nil)
+)
+
+var (
+	contextT = reflect.TypeOf((*Context)(nil))
+	errorT   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+var errWriteProtection = errors.New("kernel: write protection")
+
+// Context carries the information about a call to the handler of a system
+// contract, see vm.KernelCall for the semantics of the call types.
+type Context struct {
+	TxHash    common.Hash    // Hash of the transaction, as set by Prepare
+	Type      vm.OpCode      // CALL, CALLCODE, DELEGATECALL or STATICCALL
+	Caller    common.Address // msg.sender of the call
+	Address   common.Address // Account the call runs for
+	Value     *big.Int       // msg.value of the call
+	ReadOnly  bool           // Whether the call must not write
+	Origin    common.Address // Sender of the transaction
+	Nonce     uint64         // Nonce of the sender
+	BlockHash common.Hash    // Hash of the parent block
+
+	registry       *Registry
+	gas            uint64
+	outOfGas       bool
+	writeProtected bool
+}
+
+// UseGas charges amount gas to the call. Once the budget of the call is
+// exhausted it returns vm.ErrOutOfGas, which the handler should return.
+func (ctx *Context) UseGas(amount uint64) error {
+	if ctx.outOfGas || amount > ctx.gas {
+		ctx.gas, ctx.outOfGas = 0, true
+		return vm.ErrOutOfGas
+	}
+	ctx.gas -= amount
+	return nil
+}
+
+// Read records that the handler has read key of the state of ctx.Address.
+func (ctx *Context) Read(key string) {
+	ctx.registry.reads[accessKey(ctx.Address, key)] = struct{}{}
+}
+
+// Write records that the handler is about to write key of the state of
+// ctx.Address. Transactions reading or writing a key written by an earlier one
+// conflict with it. In a read only call it returns an error, which the handler
+// should return without writing. The call fails anyway and the writes the
+// handler has made are reverted.
+func (ctx *Context) Write(key string) error {
+	if ctx.ReadOnly {
+		ctx.writeProtected = true
+		return errWriteProtection
+	}
+	ctx.registry.writes[accessKey(ctx.Address, key)] = struct{}{}
+	return nil
+}
+
+// OnRevert registers undo to be called if the write the handler has just made
+// is reverted, because the call or a call frame above it fails or because the
+// transaction is executed again. The undo functions are called in the reverse
+// order of their registration. A write without an undo function can't be
+// reverted.
+func (ctx *Context) OnRevert(undo func()) {
+	ctx.registry.journal = append(ctx.registry.journal, undo)
+}
+
+// Gas returns the gas left to the call.
+func (ctx *Context) Gas() uint64 {
+	return ctx.gas
+}
+
+// method is a callable method of a system contract.
+type method struct {
+	sig      string
+	receiver reflect.Value
+	fn       reflect.Value
+	hasCtx   bool // method takes a *Context first
+	hasErr   bool // method returns an error last
+	inputs   []abiType
+	outputs  []abiType
+}
+
+// Registry maps reserved addresses to system contracts. It implements the
+// KernelAPI of the EVM, a call to a registered address is dispatched to the
+// method of the contract selected by the first 4 bytes of the input, as for a
+// Solidity contract.
+//
+// A Registry is owned by one EU, the contracts can be shared by registries as
+// long as they are safe for concurrent use.
+type Registry struct {
+	contracts map[common.Address]map[[4]byte]*method
+	codes     map[common.Address][]byte
+	txHash    common.Hash
+	reads     map[string]struct{}
+	writes    map[string]struct{}
+	journal   []func()
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		contracts: make(map[common.Address]map[[4]byte]*method),
+		codes:     make(map[common.Address][]byte),
+		reads:     make(map[string]struct{}),
+		writes:    make(map[string]struct{}),
+	}
+}
+
+// Register makes the exported methods of contract callable at addr. The ABI
+// name of a method is its Go name starting with a lower case letter. A method
+// may take a *Context first and return an error last, all the other arguments
+// and results must map to an ABI type: bool, intN, uintN, *big.Int for
+// uint256, common.Address, common.Hash for bytes32, string and []byte.
+//
+// Register must not be called while the Registry is in use.
+func (r *Registry) Register(addr common.Address, contract interface{}) error {
+	if _, ok := r.contracts[addr]; ok {
+		return fmt.Errorf("kernel: address %x already registered", addr)
+	}
+
+	receiver := reflect.ValueOf(contract)
+	typ := receiver.Type()
+	methods := make(map[[4]byte]*method)
+	for i := 0; i < typ.NumMethod(); i++ {
+		m, err := newMethod(receiver, typ.Method(i))
+		if err != nil {
+			return err
+		}
+
+		var selector [4]byte
+		copy(selector[:], crypto.Keccak256([]byte(m.sig)))
+		if prev, ok := methods[selector]; ok {
+			return fmt.Errorf("kernel: selector of %s clashes with %s", m.sig, prev.sig)
+		}
+		methods[selector] = m
+	}
+	if len(methods) == 0 {
+		return errors.New("kernel: contract has no exported methods")
+	}
+	r.contracts[addr] = methods
+	r.codes[addr] = stubCode(methods)
+	return nil
+}
+
+// stubCode returns the code reported for a contract with methods. The code
+// reverts if it is ever executed, it is followed by the sorted selectors of the
+// methods so that the code hash identifies the interface of the contract.
+func stubCode(methods map[[4]byte]*method) []byte {
+	selectors := make([]string, 0, len(methods))
+	for selector := range methods {
+		selectors = append(selectors, string(selector[:]))
+	}
+	sort.Strings(selectors)
+
+	// PUSH1 0 DUP1 REVERT
+	code := []byte{byte(vm.PUSH1), 0, byte(vm.DUP1), byte(vm.REVERT)}
+	for _, selector := range selectors {
+		code = append(code, selector...)
+	}
+	return code
+}
+
+func newMethod(receiver reflect.Value, m reflect.Method) (*method, error) {
+	fn := m.Type
+	meth := &method{
+		receiver: receiver,
+		fn:       m.Func,
+	}
+
+	// The first argument is the receiver.
+	in := 1
+	if fn.NumIn() > in && fn.In(in) == contextT {
+		meth.hasCtx = true
+		in++
+	}
+	var names []string
+	for ; in < fn.NumIn(); in++ {
+		t, err := newABIType(fn.In(in))
+		if err != nil {
+			return nil, fmt.Errorf("%v in arguments of %s", err, m.Name)
+		}
+		meth.inputs = append(meth.inputs, t)
+		names = append(names, t.name)
+	}
+
+	out := fn.NumOut()
+	if out > 0 && fn.Out(out-1) == errorT {
+		meth.hasErr = true
+		out--
+	}
+	for i := 0; i < out; i++ {
+		t, err := newABIType(fn.Out(i))
+		if err != nil {
+			return nil, fmt.Errorf("%v in results of %s", err, m.Name)
+		}
+		meth.outputs = append(meth.outputs, t)
+	}
+
+	name := []rune(m.Name)
+	name[0] = unicode.ToLower(name[0])
+	meth.sig = fmt.Sprintf("%s(%s)", string(name), strings.Join(names, ","))
+	return meth, nil
+}
+
+// IsKernelAPI reports whether a system contract is registered at addr.
+func (r *Registry) IsKernelAPI(addr common.Address) bool {
+	_, ok := r.contracts[addr]
+	return ok
+}
+
+// Code returns the stub code of the system contract at addr.
+func (r *Registry) Code(addr common.Address) []byte {
+	return r.codes[addr]
+}
+
+// Prepare sets the hash of the transaction the next calls are made for and
+// clears the recorded accesses and the journal. If thash is the transaction of
+// the last calls, it is executed again and the writes of the earlier execution
+// are reverted first.
+func (r *Registry) Prepare(thash common.Hash) {
+	if thash == r.txHash {
+		r.RevertToSnapshot(0)
+	}
+	r.txHash = thash
+	r.reads = make(map[string]struct{})
+	r.writes = make(map[string]struct{})
+	r.journal = nil
+}
+
+// Snapshot returns an identifier for the current position in the journal of
+// the undo functions registered with Context.OnRevert.
+func (r *Registry) Snapshot() int {
+	return len(r.journal)
+}
+
+// RevertToSnapshot calls the undo functions registered since the snapshot id
+// was taken, in reverse order, and drops them from the journal.
+func (r *Registry) RevertToSnapshot(id int) {
+	for i := len(r.journal) - 1; i >= id; i-- {
+		r.journal[i]()
+	}
+	r.journal = r.journal[:id]
+}
+
+// Collect returns the keys read and written by the handlers since the last
+// Prepare, prefixed with the address of their contract.
+func (r *Registry) Collect() (reads, writes []string) {
+	return sortedKeys(r.reads), sortedKeys(r.writes)
+}
+
+// accessKey returns the key recorded for key of the contract at addr.
+func accessKey(addr common.Address, key string) string {
+	return addr.Hex() + "/" + key
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Call runs the method of the system contract at call.Callee selected by the
+// input. Every call costs params.KernelAPICallGas plus params.KernelAPIWordGas
+// per word of input, charged before the method is selected, the gas used by
+// the method through its Context comes on top. The call fails if no method
+// matches the input, if the arguments can't be decoded, if the method returns
+// an error or panics, or if it tries to write in a read only call. A call
+// running out of gas reports more gas used than its budget.
+func (r *Registry) Call(call *vm.KernelCall) ([]byte, uint64, bool) {
+	cost := params.KernelAPICallGas + params.KernelAPIWordGas*uint64((len(call.Input)+31)/32)
+	if cost > call.Gas {
+		return nil, math.MaxUint64, false
+	}
+
+	if len(call.Input) < 4 {
+		return nil, cost, false
+	}
+	var selector [4]byte
+	copy(selector[:], call.Input)
+	m, ok := r.contracts[call.Callee][selector]
+	if !ok {
+		return nil, cost, false
+	}
+	args, err := unpack(m.inputs, call.Input[4:])
+	if err != nil {
+		return nil, cost, false
+	}
+
+	gas := call.Gas
+	ctx := &Context{
+		TxHash:    r.txHash,
+		Type:      call.Type,
+		Caller:    call.Caller,
+		Address:   call.Address,
+		Value:     call.Value,
+		ReadOnly:  call.ReadOnly,
+		Origin:    call.Origin,
+		Nonce:     call.Nonce,
+		BlockHash: call.BlockHash,
+		registry:  r,
+		gas:       gas - cost,
+	}
+	in := []reflect.Value{m.receiver}
+	if m.hasCtx {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	snapshot := r.Snapshot()
+	out, ok := invoke(m.fn, append(in, args...))
+	if !ok || ctx.writeProtected {
+		// The handler has panicked or ignored the write protection, drop what
+		// it has written.
+		r.RevertToSnapshot(snapshot)
+	}
+
+	if ctx.outOfGas {
+		// Report more than any budget, the EVM fails the call with ErrOutOfGas.
+		return nil, math.MaxUint64, false
+	}
+	if !ok || ctx.writeProtected || m.hasErr && !out[len(out)-1].IsNil() {
+		return nil, gas - ctx.gas, false
+	}
+	return pack(m.outputs, out[:len(m.outputs)]), gas - ctx.gas, true
+}
+
+// invoke calls fn with in, a panic of fn is reported as a failure instead of
+// crashing the EU.
+func invoke(fn reflect.Value, in []reflect.Value) (out []reflect.Value, ok bool) {
+	defer func() {
+		if recover() != nil {
+			out, ok = nil, false
+		}
+	}()
+	return fn.Call(in), true
+}
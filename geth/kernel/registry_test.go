@@ -0,0 +1,350 @@
+package kernel
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/HPISTechnologies/mevm/geth/common"
+	"github.com/HPISTechnologies/mevm/geth/core/vm"
+	"github.com/HPISTechnologies/mevm/geth/crypto"
+	"github.com/HPISTechnologies/mevm/geth/params"
+)
+
+// testArray is a ConcurrentArray as declared in core/sc2.sol.
+type testArray struct {
+	arrays map[string][]int64
+}
+
+func (ca *testArray) Create(ctx *Context, id string) error {
+	if err := ctx.UseGas(20000); err != nil {
+		return err
+	}
+	if err := ctx.Write(id); err != nil {
+		return err
+	}
+	ca.arrays[id] = nil
+	return nil
+}
+
+func (ca *testArray) Append(ctx *Context, id string, value int64) error {
+	if err := ctx.UseGas(5000); err != nil {
+		return err
+	}
+	if err := ctx.Write(id); err != nil {
+		return err
+	}
+	n := len(ca.arrays[id])
+	ca.arrays[id] = append(ca.arrays[id], value)
+	ctx.OnRevert(func() {
+		ca.arrays[id] = ca.arrays[id][:n]
+	})
+	return nil
+}
+
+func (ca *testArray) Get(ctx *Context, id string, index int32) (int64, error) {
+	ctx.Read(id)
+	if int(index) >= len(ca.arrays[id]) {
+		return 0, errors.New("index out of range")
+	}
+	return ca.arrays[id][index], nil
+}
+
+func testInput(t *testing.T, sig string, args ...interface{}) []byte {
+	var (
+		types  []abiType
+		values []reflect.Value
+	)
+	for _, arg := range args {
+		typ, err := newABIType(reflect.TypeOf(arg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, typ)
+		values = append(values, reflect.ValueOf(arg))
+	}
+	return append(crypto.Keccak256([]byte(sig))[:4], pack(types, values)...)
+}
+
+// callCost returns the gas charged by Registry.Call before dispatching input.
+func callCost(input []byte) uint64 {
+	return params.KernelAPICallGas + params.KernelAPIWordGas*uint64((len(input)+31)/32)
+}
+
+func TestRegistry(t *testing.T) {
+	api := common.BytesToAddress([]byte{0x80})
+	caller := common.BytesToAddress([]byte{1})
+
+	registry := NewRegistry()
+	if err := registry.Register(api, &testArray{arrays: make(map[string][]int64)}); err != nil {
+		t.Errorf("Checking Register failed, got %v", err)
+		return
+	}
+	if !registry.IsKernelAPI(api) || registry.IsKernelAPI(caller) {
+		t.Error("Checking IsKernelAPI failed")
+		return
+	}
+	if code := registry.Code(api); len(code) != 4+3*4 || !bytes.Equal(code[:4], []byte{0x60, 0x00, 0x80, 0xfd}) || registry.Code(caller) != nil {
+		t.Errorf("Checking Code failed, got %x", code)
+		return
+	}
+
+	call := func(input []byte, gas uint64) ([]byte, uint64, bool) {
+		return registry.Call(&vm.KernelCall{
+			Type:    vm.CALL,
+			Caller:  caller,
+			Address: api,
+			Callee:  api,
+			Input:   input,
+			Value:   new(big.Int),
+			Origin:  caller,
+			Gas:     gas,
+		})
+	}
+	input := testInput(t, "create(string)", "users")
+	if _, used, ok := call(input, 100000); !ok || used != callCost(input)+20000 {
+		t.Error("Checking create failed")
+		return
+	}
+	input = testInput(t, "append(string,int64)", "users", int64(-7))
+	if _, used, ok := call(input, 100000); !ok || used != callCost(input)+5000 {
+		t.Error("Checking append failed")
+		return
+	}
+	registry.Prepare(common.Hash{1})
+	input = testInput(t, "get(string,int32)", "users", int32(0))
+	ret, used, ok := call(input, 100000)
+	if !ok || used != callCost(input) || !bytes.Equal(ret, common.LeftPadBytes(new(big.Int).Sub(new(big.Int).Lsh(common.Big1, 256), big.NewInt(7)).Bytes(), 32)) {
+		t.Errorf("Checking get failed, got %x", ret)
+		return
+	}
+	if reads, writes := registry.Collect(); len(reads) != 1 || reads[0] != api.Hex()+"/users" || len(writes) != 0 {
+		t.Errorf("Checking Collect failed, got %v %v", reads, writes)
+		return
+	}
+
+	if _, _, ok := call(testInput(t, "get(string,int32)", "users", int32(1)), 100000); ok {
+		t.Error("Checking failing method failed")
+		return
+	}
+	if _, used, ok := call(testInput(t, "append(string,int64)", "users", int64(1)), 5000); ok || used <= 5000 {
+		t.Error("Checking out of gas failed")
+		return
+	}
+	if _, _, ok := registry.Call(&vm.KernelCall{
+		Type:     vm.STATICCALL,
+		Caller:   caller,
+		Address:  api,
+		Callee:   api,
+		Input:    testInput(t, "append(string,int64)", "users", int64(1)),
+		Value:    new(big.Int),
+		ReadOnly: true,
+		Gas:      100000,
+	}); ok {
+		t.Error("Checking write protection failed")
+		return
+	}
+	if _, _, ok := call(testInput(t, "remove(string)", "users"), 100000); ok {
+		t.Error("Checking unknown selector failed")
+		return
+	}
+	if _, _, ok := call(testInput(t, "get(string,int32)", "users", int64(1<<40)), 100000); ok {
+		t.Error("Checking invalid argument failed")
+		return
+	}
+	if _, _, ok := call(testInput(t, "create(string)", "users")[:40], 100000); ok {
+		t.Error("Checking short input failed")
+		return
+	}
+}
+
+func TestRegistryRevert(t *testing.T) {
+	api := common.BytesToAddress([]byte{0x80})
+	array := &testArray{arrays: map[string][]int64{"users": nil}}
+	registry := NewRegistry()
+	if err := registry.Register(api, array); err != nil {
+		t.Errorf("Checking Register failed, got %v", err)
+		return
+	}
+	appendValue := func(value int64) {
+		registry.Call(&vm.KernelCall{
+			Type:    vm.CALL,
+			Address: api,
+			Callee:  api,
+			Input:   testInput(t, "append(string,int64)", "users", value),
+			Value:   new(big.Int),
+			Gas:     100000,
+		})
+	}
+
+	registry.Prepare(common.Hash{1})
+	appendValue(1)
+	outer := registry.Snapshot()
+	appendValue(2)
+	inner := registry.Snapshot()
+	appendValue(3)
+	registry.RevertToSnapshot(inner)
+	if !reflect.DeepEqual(array.arrays["users"], []int64{1, 2}) {
+		t.Errorf("Checking inner revert failed, got %v", array.arrays["users"])
+		return
+	}
+	registry.RevertToSnapshot(outer)
+	if !reflect.DeepEqual(array.arrays["users"], []int64{1}) {
+		t.Errorf("Checking outer revert failed, got %v", array.arrays["users"])
+		return
+	}
+}
+
+// testVersion has no method taking a *Context.
+type testVersion struct{}
+
+func (v *testVersion) Version() uint64 {
+	return 1
+}
+
+func TestRegistryReexecution(t *testing.T) {
+	api := common.BytesToAddress([]byte{0x80})
+	array := &testArray{arrays: map[string][]int64{"users": nil}}
+	registry := NewRegistry()
+	if err := registry.Register(api, array); err != nil {
+		t.Errorf("Checking Register failed, got %v", err)
+		return
+	}
+	appendValue := func(value int64) {
+		registry.Call(&vm.KernelCall{
+			Type:    vm.CALL,
+			Address: api,
+			Callee:  api,
+			Input:   testInput(t, "append(string,int64)", "users", value),
+			Value:   new(big.Int),
+			Gas:     100000,
+		})
+	}
+
+	// The writes of a transaction are kept once the next one is prepared.
+	registry.Prepare(common.Hash{1})
+	appendValue(1)
+	registry.Prepare(common.Hash{2})
+	appendValue(2)
+	if !reflect.DeepEqual(array.arrays["users"], []int64{1, 2}) {
+		t.Errorf("Checking writes failed, got %v", array.arrays["users"])
+		return
+	}
+
+	// Executing the transaction again drops the writes of the first execution.
+	registry.Prepare(common.Hash{2})
+	appendValue(3)
+	if !reflect.DeepEqual(array.arrays["users"], []int64{1, 3}) {
+		t.Errorf("Checking re-execution failed, got %v", array.arrays["users"])
+		return
+	}
+}
+
+func TestRegistryGas(t *testing.T) {
+	api := common.BytesToAddress([]byte{0x82})
+	registry := NewRegistry()
+	if err := registry.Register(api, &testVersion{}); err != nil {
+		t.Errorf("Checking Register failed, got %v", err)
+		return
+	}
+	call := func(input []byte, gas uint64) ([]byte, uint64, bool) {
+		return registry.Call(&vm.KernelCall{
+			Type:    vm.CALL,
+			Address: api,
+			Callee:  api,
+			Input:   input,
+			Value:   new(big.Int),
+			Gas:     gas,
+		})
+	}
+
+	// The base and input costs are charged whatever the method does.
+	input := testInput(t, "version()")
+	if _, used, ok := call(input, 100000); !ok || used != params.KernelAPICallGas+params.KernelAPIWordGas {
+		t.Errorf("Checking gas of version failed, got %d", used)
+		return
+	}
+	long := append(testInput(t, "version()"), make([]byte, 64)...)
+	if _, used, _ := call(long, 100000); used != params.KernelAPICallGas+3*params.KernelAPIWordGas {
+		t.Errorf("Checking gas of long input failed, got %d", used)
+		return
+	}
+	if _, used, ok := call(testInput(t, "unknown()"), 100000); ok || used != callCost(input) {
+		t.Errorf("Checking gas of unknown selector failed, got %d", used)
+		return
+	}
+	if _, used, ok := call(input, callCost(input)-1); ok || used <= callCost(input)-1 {
+		t.Error("Checking out of gas failed")
+		return
+	}
+}
+
+// testRogue ignores the write protection and panics.
+type testRogue struct {
+	values []int64
+}
+
+func (c *testRogue) Push(ctx *Context, value int64) {
+	ctx.Write("values")
+	n := len(c.values)
+	c.values = append(c.values, value)
+	ctx.OnRevert(func() {
+		c.values = c.values[:n]
+	})
+}
+
+func (c *testRogue) Crash(ctx *Context, value int64) {
+	c.Push(ctx, value)
+	panic("crash")
+}
+
+func TestRegistryRogue(t *testing.T) {
+	api := common.BytesToAddress([]byte{0x83})
+	rogue := &testRogue{}
+	registry := NewRegistry()
+	if err := registry.Register(api, rogue); err != nil {
+		t.Errorf("Checking Register failed, got %v", err)
+		return
+	}
+	call := func(input []byte, readOnly bool) bool {
+		_, _, ok := registry.Call(&vm.KernelCall{
+			Type:     vm.CALL,
+			Address:  api,
+			Callee:   api,
+			Input:    input,
+			Value:    new(big.Int),
+			Gas:      100000,
+			ReadOnly: readOnly,
+		})
+		return ok
+	}
+
+	registry.Prepare(common.Hash{1})
+	if !call(testInput(t, "push(int64)", int64(1)), false) {
+		t.Error("Checking push failed")
+		return
+	}
+	if call(testInput(t, "push(int64)", int64(2)), true) || !reflect.DeepEqual(rogue.values, []int64{1}) {
+		t.Errorf("Checking read only push failed, got %v", rogue.values)
+		return
+	}
+	if call(testInput(t, "crash(int64)", int64(3)), false) || !reflect.DeepEqual(rogue.values, []int64{1}) {
+		t.Errorf("Checking crash failed, got %v", rogue.values)
+		return
+	}
+}
+
+type unsupportedContract struct{}
+
+func (c *unsupportedContract) Sum(values []int64) int64 {
+	return 0
+}
+
+func TestRegisterUnsupported(t *testing.T) {
+	if err := NewRegistry().Register(common.BytesToAddress([]byte{0x81}), &unsupportedContract{}); err == nil {
+		t.Error("Checking unsupported type failed")
+		return
+	}
+}
@@ -0,0 +1,71 @@
+package params
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestMainnetRules(t *testing.T) {
+	// The forks are taken from the config, a missing one is never active.
+	rules := MainnetChainConfig.Rules(big.NewInt(5000000))
+	expected := Rules{
+		ChainID:     big.NewInt(1),
+		IsHomestead: true,
+		IsEIP150:    true,
+		IsEIP155:    true,
+		IsEIP158:    true,
+		IsByzantium: true,
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Checking rules failed, got %+v", rules)
+		return
+	}
+
+	if rules := MainnetChainConfig.Rules(big.NewInt(1000000)); rules.IsHomestead || rules.IsByzantium {
+		t.Errorf("Checking rules before Homestead failed, got %+v", rules)
+		return
+	}
+	if gt := MainnetChainConfig.GasTable(big.NewInt(5000000)); gt != GasTableEIP158 {
+		t.Error("Checking gas table failed")
+		return
+	}
+
+	for _, test := range []struct {
+		number                       int64
+		petersburg, istanbul, berlin bool
+		gt                           GasTable
+	}{
+		{7279999, false, false, false, GasTableEIP158},
+		{7280000, true, false, false, GasTableConstantinople},
+		{9069000, true, true, false, GasTableIstanbul},
+		{12244000, true, true, true, GasTableBerlin},
+	} {
+		rules := MainnetChainConfig.Rules(big.NewInt(test.number))
+		if rules.IsConstantinople != test.petersburg || rules.IsPetersburg != test.petersburg ||
+			rules.IsIstanbul != test.istanbul || rules.IsBerlin != test.berlin {
+			t.Errorf("Checking rules at block %d failed, got %+v", test.number, rules)
+			return
+		}
+		if gt := MainnetChainConfig.GasTable(big.NewInt(test.number)); gt != test.gt {
+			t.Errorf("Checking gas table at block %d failed", test.number)
+			return
+		}
+	}
+}
+
+func TestPetersburg(t *testing.T) {
+	// A missing Petersburg block follows Constantinople.
+	config := *TestChainConfig
+	config.ConstantinopleBlock = big.NewInt(5)
+	config.PetersburgBlock = nil
+	if config.IsPetersburg(big.NewInt(4)) || !config.IsPetersburg(big.NewInt(5)) {
+		t.Error("Checking Petersburg without a block failed")
+		return
+	}
+	config.PetersburgBlock = big.NewInt(6)
+	if config.IsPetersburg(big.NewInt(5)) || !config.IsPetersburg(big.NewInt(6)) {
+		t.Error("Checking Petersburg block failed")
+		return
+	}
+}